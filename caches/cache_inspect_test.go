@@ -0,0 +1,98 @@
+package caches
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/JoshPattman/jpf"
+)
+
+func testInspectable(t *testing.T, cache jpf.ModelResponseCache) {
+	ctx := context.Background()
+	inspectable, ok := cache.(Inspectable)
+	if !ok {
+		t.Fatalf("%T does not implement Inspectable", cache)
+	}
+	inputsA := []jpf.Message{jpf.SystemMessage{Content: "sys"}, jpf.UserMessage{Content: "a"}}
+	inputsB := []jpf.Message{jpf.UserMessage{Content: "b"}}
+	if err := cache.SetCachedResponse(ctx, "s1", inputsA, jpf.AssistantMessage{Content: "A"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.SetCachedResponse(ctx, "s2", inputsB, jpf.AssistantMessage{Content: "B"}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := inspectable.Entries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	for _, e := range entries {
+		expectedInputs := inputsA
+		if e.Salt == "s2" {
+			expectedInputs = inputsB
+		}
+		if e.Hash != HashMessages(e.Salt, expectedInputs) {
+			t.Fatalf("entry hash did not match its salt and inputs")
+		}
+		if len(e.Inputs) != len(expectedInputs) {
+			t.Fatalf("expected %d inputs, got %d", len(expectedInputs), len(e.Inputs))
+		}
+		for i := range e.Inputs {
+			if !e.Inputs[i].Eq(expectedInputs[i]) {
+				t.Fatalf("expected input %v, got %v", expectedInputs[i], e.Inputs[i])
+			}
+		}
+		if time.Since(e.Created) > time.Minute {
+			t.Fatalf("entry had unexpected creation time %v", e.Created)
+		}
+	}
+	if err := inspectable.DeleteEntries(ctx, []string{HashMessages("s1", inputsA)}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _, _ := cache.GetCachedResponse(ctx, "s1", inputsA); ok {
+		t.Fatal("expected deleted entry to be missing")
+	}
+	created := time.Unix(1000, 0)
+	if err := inspectable.AddEntries(ctx, []Entry{{Salt: "s3", Inputs: inputsA, Output: jpf.AssistantMessage{Content: "C"}, Created: created}}); err != nil {
+		t.Fatal(err)
+	}
+	ok, out, err := cache.GetCachedResponse(ctx, "s3", inputsA)
+	if err != nil || !ok || out.Content != "C" {
+		t.Fatalf("expected added entry to be a hit, got ok=%v out=%v err=%v", ok, out, err)
+	}
+	entries, err = inspectable.Entries(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || !entries[0].Created.Equal(created) {
+		t.Fatalf("expected the added entry to be listed first, got %v", entries)
+	}
+}
+
+func TestInspectRAM(t *testing.T) {
+	testInspectable(t, NewRAM())
+}
+
+func TestInspectFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "cache.gob")
+	cache, err := NewFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testInspectable(t, cache)
+	reloaded, err := NewFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := reloaded.(Inspectable).Entries(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || len(entries[0].Inputs) != 2 {
+		t.Fatalf("expected entries with inputs to persist, got %v", entries)
+	}
+}
@@ -2,12 +2,17 @@ package caches
 
 import (
 	"context"
+	"maps"
+	"sync"
+	"time"
 
 	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/internal/utils"
 )
 
 // NewRAM creates an in-memory implementation of ModelResponseCache.
 // It stores model responses in memory using a hash of the input messages as a key.
+// It is safe for concurrent use, and implements [Inspectable].
 func NewRAM() jpf.ModelResponseCache {
 	return &inMemoryCache{
 		Resps: make(map[string]memoryCachePacket),
@@ -15,15 +20,21 @@ func NewRAM() jpf.ModelResponseCache {
 }
 
 type memoryCachePacket struct {
-	Final jpf.AssistantMessage
+	Final   jpf.AssistantMessage
+	Salt    string
+	Inputs  []utils.JsonMessage
+	Created time.Time
 }
 
 type inMemoryCache struct {
+	mu    sync.Mutex
 	Resps map[string]memoryCachePacket
 }
 
 // GetCachedResponse implements ModelResponseCache.
 func (i *inMemoryCache) GetCachedResponse(ctx context.Context, salt string, msgs []jpf.Message) (bool, jpf.AssistantMessage, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
 	msgsHash := HashMessages(salt, msgs)
 	if cp, ok := i.Resps[msgsHash]; ok {
 		return true, cp.Final, nil
@@ -33,9 +44,34 @@ func (i *inMemoryCache) GetCachedResponse(ctx context.Context, salt string, msgs
 
 // SetCachedResponse implements ModelResponseCache.
 func (i *inMemoryCache) SetCachedResponse(ctx context.Context, salt string, inputs []jpf.Message, out jpf.AssistantMessage) error {
-	msgsHash := HashMessages(salt, inputs)
-	i.Resps[msgsHash] = memoryCachePacket{
-		Final: out,
+	return i.AddEntries(ctx, []Entry{{Salt: salt, Inputs: inputs, Output: out, Created: time.Now()}})
+}
+
+// Entries implements Inspectable.
+func (i *inMemoryCache) Entries(ctx context.Context) ([]Entry, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return packetsToEntries(i.Resps)
+}
+
+// AddEntries implements Inspectable.
+func (i *inMemoryCache) AddEntries(ctx context.Context, entries []Entry) error {
+	packets, err := packetsFromEntries(entries)
+	if err != nil {
+		return err
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	maps.Copy(i.Resps, packets)
+	return nil
+}
+
+// DeleteEntries implements Inspectable.
+func (i *inMemoryCache) DeleteEntries(ctx context.Context, hashes []string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, h := range hashes {
+		delete(i.Resps, h)
 	}
 	return nil
 }
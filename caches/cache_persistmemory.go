@@ -3,8 +3,10 @@ package caches
 import (
 	"context"
 	"encoding/gob"
+	"maps"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/JoshPattman/jpf"
 )
@@ -12,6 +14,7 @@ import (
 // NewFile creates an in-memory cache that persists to the given filename.
 // On creation, it loads the cache from the file (if it exists). Whenever SetCachedResponse
 // is called, the entire cache is saved back to the file.
+// It implements [Inspectable].
 func NewFile(filename string) (jpf.ModelResponseCache, error) {
 	cache := &filePersistCache{
 		resps:    make(map[string]memoryCachePacket),
@@ -72,10 +75,34 @@ func (f *filePersistCache) GetCachedResponse(ctx context.Context, salt string, m
 }
 
 func (f *filePersistCache) SetCachedResponse(ctx context.Context, salt string, inputs []jpf.Message, out jpf.AssistantMessage) error {
+	return f.AddEntries(ctx, []Entry{{Salt: salt, Inputs: inputs, Output: out, Created: time.Now()}})
+}
+
+// Entries implements Inspectable.
+func (f *filePersistCache) Entries(ctx context.Context) ([]Entry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return packetsToEntries(f.resps)
+}
+
+// AddEntries implements Inspectable. The file is only saved once, after every entry has been added.
+func (f *filePersistCache) AddEntries(ctx context.Context, entries []Entry) error {
+	packets, err := packetsFromEntries(entries)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	maps.Copy(f.resps, packets)
+	f.mu.Unlock()
+
+	return f.save()
+}
+
+// DeleteEntries implements Inspectable.
+func (f *filePersistCache) DeleteEntries(ctx context.Context, hashes []string) error {
 	f.mu.Lock()
-	msgsHash := HashMessages(salt, inputs)
-	f.resps[msgsHash] = memoryCachePacket{
-		Final: out,
+	for _, h := range hashes {
+		delete(f.resps, h)
 	}
 	f.mu.Unlock()
 
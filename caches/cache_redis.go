@@ -0,0 +1,368 @@
+package caches
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/internal/utils"
+)
+
+var ErrRedisUnavailable = errors.New("redis server is unavailable")
+
+// NewRedis creates a ModelResponseCache backed by a server speaking the Redis (RESP) protocol at the given address.
+// This allows many replicas of a service to share cache hits without adding load to a database.
+// Keys are namespaced by the key prefix and the salt, and stored messages are gzip compressed by default.
+// When the server is unreachable, the cache degrades gracefully: gets are treated as misses and sets are dropped,
+// unless [WithStrictErrors] is specified.
+func NewRedis(addr string, opts ...RedisCacheOpt) jpf.ModelResponseCache {
+	c := &redisCache{
+		addr:        addr,
+		prefix:      "jpf:",
+		compress:    true,
+		dialTimeout: time.Second,
+		ioTimeout:   time.Second * 5,
+		backoff:     time.Second * 5,
+		maxIdle:     4,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	c.idle = make(chan *redisConn, c.maxIdle)
+	return c
+}
+
+type RedisCacheOpt func(*redisCache)
+
+// Expire cached responses after the given duration (by default, they never expire).
+func WithTTL(ttl time.Duration) RedisCacheOpt {
+	return func(c *redisCache) { c.ttl = ttl }
+}
+
+// Use the given prefix for all keys (default "jpf:"). Keys have the form <prefix><salt>:<hash>.
+func WithKeyPrefix(prefix string) RedisCacheOpt {
+	return func(c *redisCache) { c.prefix = prefix }
+}
+
+// Authenticate with the given password when connecting.
+func WithPassword(password string) RedisCacheOpt {
+	return func(c *redisCache) { c.password = password }
+}
+
+// Select the given database index when connecting.
+func WithDB(db int) RedisCacheOpt {
+	return func(c *redisCache) { c.db = db }
+}
+
+// Store messages without gzip compression.
+func WithoutCompression() RedisCacheOpt {
+	return func(c *redisCache) { c.compress = false }
+}
+
+// Set the timeout for connecting, and for each command sent to the server.
+func WithTimeouts(dial, command time.Duration) RedisCacheOpt {
+	return func(c *redisCache) {
+		c.dialTimeout = dial
+		c.ioTimeout = command
+	}
+}
+
+// Set how long to wait after failing to reach the server before trying again.
+// During this time, the cache will not attempt to connect at all.
+func WithBackoff(backoff time.Duration) RedisCacheOpt {
+	return func(c *redisCache) { c.backoff = backoff }
+}
+
+// Return errors (joined with [ErrRedisUnavailable]) when the server cannot be reached, instead of degrading gracefully.
+func WithStrictErrors() RedisCacheOpt {
+	return func(c *redisCache) { c.strict = true }
+}
+
+type redisCache struct {
+	addr        string
+	prefix      string
+	password    string
+	db          int
+	ttl         time.Duration
+	compress    bool
+	strict      bool
+	dialTimeout time.Duration
+	ioTimeout   time.Duration
+	backoff     time.Duration
+	maxIdle     int
+
+	idle      chan *redisConn
+	mu        sync.Mutex
+	downUntil time.Time
+}
+
+// GetCachedResponse implements ModelResponseCache.
+func (c *redisCache) GetCachedResponse(ctx context.Context, salt string, inputs []jpf.Message) (bool, jpf.AssistantMessage, error) {
+	reply, err := c.do(ctx, "GET", c.key(salt, inputs))
+	if err != nil {
+		return false, jpf.AssistantMessage{}, c.unavailable(err)
+	}
+	blob, ok := reply.([]byte)
+	if !ok {
+		return false, jpf.AssistantMessage{}, nil
+	}
+	msg, err := c.decode(blob)
+	if err != nil {
+		return false, jpf.AssistantMessage{}, utils.Wrap(err, "failed to decode cached data")
+	}
+	return true, msg, nil
+}
+
+// SetCachedResponse implements ModelResponseCache.
+func (c *redisCache) SetCachedResponse(ctx context.Context, salt string, inputs []jpf.Message, out jpf.AssistantMessage) error {
+	blob, err := c.encode(out)
+	if err != nil {
+		return utils.Wrap(err, "failed to encode messages to binary data")
+	}
+	args := []string{"SET", c.key(salt, inputs), string(blob)}
+	if c.ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(c.ttl.Milliseconds(), 10))
+	}
+	_, err = c.do(ctx, args...)
+	if err != nil {
+		return c.unavailable(err)
+	}
+	return nil
+}
+
+func (c *redisCache) key(salt string, inputs []jpf.Message) string {
+	return c.prefix + salt + ":" + HashMessages(salt, inputs)
+}
+
+func (c *redisCache) encode(msg jpf.AssistantMessage) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	var w io.Writer = buf
+	var zw *gzip.Writer
+	if c.compress {
+		zw = gzip.NewWriter(buf)
+		w = zw
+	}
+	if err := gob.NewEncoder(w).Encode(msg); err != nil {
+		return nil, err
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// decode reads a stored message, detecting whether it was compressed so that the compression setting may change over time.
+func (c *redisCache) decode(blob []byte) (jpf.AssistantMessage, error) {
+	var r io.Reader = bytes.NewReader(blob)
+	if len(blob) >= 2 && blob[0] == 0x1f && blob[1] == 0x8b {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return jpf.AssistantMessage{}, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	var msg jpf.AssistantMessage
+	err := gob.NewDecoder(r).Decode(&msg)
+	return msg, err
+}
+
+// unavailable converts an error talking to the server into the error to return to the caller.
+// Errors returned by the server itself are always returned, but connection errors are swallowed unless the cache is strict.
+func (c *redisCache) unavailable(err error) error {
+	var serverErr redisError
+	if errors.As(err, &serverErr) {
+		return utils.Wrap(err, "redis server returned an error")
+	}
+	if c.strict {
+		return errors.Join(ErrRedisUnavailable, err)
+	}
+	return nil
+}
+
+// do runs a single command on a pooled connection, returning the reply.
+func (c *redisCache) do(ctx context.Context, args ...string) (any, error) {
+	conn, pooled, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := conn.do(ctx, c.ioTimeout, args...)
+	var serverErr redisError
+	if err != nil && pooled && ctx.Err() == nil && !errors.As(err, &serverErr) {
+		// The server may have closed the idle connection, so try once on a fresh connection before backing off.
+		conn.Close()
+		conn, err = c.dial(ctx)
+		if err != nil {
+			c.markDown(ctx)
+			return nil, err
+		}
+		reply, err = conn.do(ctx, c.ioTimeout, args...)
+	}
+	if err != nil {
+		if errors.As(err, &serverErr) {
+			c.put(conn)
+		} else {
+			conn.Close()
+			c.markDown(ctx)
+		}
+		return nil, err
+	}
+	c.put(conn)
+	return reply, nil
+}
+
+// get returns an idle connection if there is one, otherwise it dials a new one.
+// It also reports whether the connection came from the pool.
+func (c *redisCache) get(ctx context.Context) (*redisConn, bool, error) {
+	select {
+	case conn := <-c.idle:
+		return conn, true, nil
+	default:
+	}
+	c.mu.Lock()
+	downUntil := c.downUntil
+	c.mu.Unlock()
+	if time.Now().Before(downUntil) {
+		return nil, false, errors.New("not reconnecting to redis server while backing off")
+	}
+	conn, err := c.dial(ctx)
+	if err != nil {
+		c.markDown(ctx)
+		return nil, false, err
+	}
+	return conn, false, nil
+}
+
+func (c *redisCache) put(conn *redisConn) {
+	select {
+	case c.idle <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// markDown stops reconnecting to the server until the backoff has passed, after a connection error.
+// Errors caused by the caller's context ending are not the server's fault, so do not mark it down.
+func (c *redisCache) markDown(ctx context.Context) {
+	if ctx.Err() != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.downUntil = time.Now().Add(c.backoff)
+}
+
+func (c *redisCache) dial(ctx context.Context) (*redisConn, error) {
+	dialer := &net.Dialer{Timeout: c.dialTimeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, utils.Wrap(err, "failed to connect to redis server")
+	}
+	conn := &redisConn{Conn: netConn, r: bufio.NewReader(netConn)}
+	if c.password != "" {
+		if _, err := conn.do(ctx, c.ioTimeout, "AUTH", c.password); err != nil {
+			conn.Close()
+			return nil, utils.Wrap(err, "failed to authenticate with redis server")
+		}
+	}
+	if c.db != 0 {
+		if _, err := conn.do(ctx, c.ioTimeout, "SELECT", strconv.Itoa(c.db)); err != nil {
+			conn.Close()
+			return nil, utils.Wrap(err, "failed to select redis database")
+		}
+	}
+	return conn, nil
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (conn *redisConn) do(ctx context.Context, timeout time.Duration, args ...string) (any, error) {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(nil)
+	fmt.Fprintf(buf, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(buf, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		return nil, utils.Wrap(err, "failed to write command")
+	}
+	return readRESP(conn.r)
+}
+
+// redisError is an error reply sent by the server.
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+// readRESP reads a single reply. Bulk strings are returned as []byte (nil if missing),
+// simple strings as string, integers as int64, and arrays as []any.
+func readRESP(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, utils.Wrap(err, "failed to read reply")
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed reply line %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, utils.Wrap(err, "malformed bulk string length")
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, utils.Wrap(err, "failed to read bulk string")
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, utils.Wrap(err, "malformed array length")
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			items[i], err = readRESP(r)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unknown reply type %q", kind)
+	}
+}
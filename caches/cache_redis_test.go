@@ -0,0 +1,255 @@
+package caches
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JoshPattman/jpf"
+)
+
+// fakeRedis is a tiny in-process server that speaks enough of the RESP protocol to test the redis cache.
+type fakeRedis struct {
+	lis      net.Listener
+	password string
+	mu       sync.Mutex
+	data     map[string]fakeRedisEntry
+	conns    []net.Conn
+}
+
+type fakeRedisEntry struct {
+	value   string
+	expires time.Time
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeRedis{lis: lis, password: password, data: make(map[string]fakeRedisEntry)}
+	go s.serve()
+	t.Cleanup(func() { lis.Close() })
+	return s
+}
+
+func (s *fakeRedis) addr() string { return s.lis.Addr().String() }
+
+func (s *fakeRedis) keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := []string{}
+	for k := range s.data {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (s *fakeRedis) serve() {
+	for {
+		conn, err := s.lis.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+// dropConns closes every connection accepted so far, as a server does when idle connections time out.
+func (s *fakeRedis) dropConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := s.password == ""
+	for {
+		req, err := readRESP(r)
+		if err != nil {
+			return
+		}
+		items, _ := req.([]any)
+		args := make([]string, len(items))
+		for i, item := range items {
+			b, _ := item.([]byte)
+			args[i] = string(b)
+		}
+		if len(args) == 0 {
+			return
+		}
+		cmd := strings.ToUpper(args[0])
+		switch {
+		case cmd == "AUTH":
+			if args[1] != s.password {
+				conn.Write([]byte("-WRONGPASS invalid password\r\n"))
+				continue
+			}
+			authed = true
+			conn.Write([]byte("+OK\r\n"))
+		case !authed:
+			conn.Write([]byte("-NOAUTH authentication required\r\n"))
+		case cmd == "SELECT":
+			conn.Write([]byte("+OK\r\n"))
+		case cmd == "GET":
+			s.mu.Lock()
+			e, ok := s.data[args[1]]
+			if ok && !e.expires.IsZero() && time.Now().After(e.expires) {
+				delete(s.data, args[1])
+				ok = false
+			}
+			s.mu.Unlock()
+			if !ok {
+				conn.Write([]byte("$-1\r\n"))
+				continue
+			}
+			conn.Write([]byte("$" + strconv.Itoa(len(e.value)) + "\r\n" + e.value + "\r\n"))
+		case cmd == "SET":
+			e := fakeRedisEntry{value: args[2]}
+			if len(args) == 5 && strings.ToUpper(args[3]) == "PX" {
+				ms, _ := strconv.Atoi(args[4])
+				e.expires = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			}
+			s.mu.Lock()
+			s.data[args[1]] = e
+			s.mu.Unlock()
+			conn.Write([]byte("+OK\r\n"))
+		default:
+			conn.Write([]byte("-ERR unknown command\r\n"))
+		}
+	}
+}
+
+var redisTestInputs = []jpf.Message{jpf.UserMessage{Content: "hello"}}
+
+func TestRedisCacheRoundTrip(t *testing.T) {
+	server := newFakeRedis(t, "secret")
+	for _, compress := range []bool{true, false} {
+		opts := []RedisCacheOpt{WithPassword("secret"), WithKeyPrefix("test:")}
+		if !compress {
+			opts = append(opts, WithoutCompression())
+		}
+		cache := NewRedis(server.addr(), opts...)
+		ctx := context.Background()
+		salt := "salt-" + strconv.FormatBool(compress)
+		ok, _, err := cache.GetCachedResponse(ctx, salt, redisTestInputs)
+		if err != nil || ok {
+			t.Fatalf("expected a clean miss, got ok=%v err=%v", ok, err)
+		}
+		out := jpf.AssistantMessage{Content: "hi", ToolCalls: []jpf.ToolCall{{ID: "1", Tool: "t", Args: map[string]any{"a": "b"}}}}
+		if err := cache.SetCachedResponse(ctx, salt, redisTestInputs, out); err != nil {
+			t.Fatal(err)
+		}
+		ok, got, err := cache.GetCachedResponse(ctx, salt, redisTestInputs)
+		if err != nil || !ok {
+			t.Fatalf("expected a hit, got ok=%v err=%v", ok, err)
+		}
+		if !got.Eq(out) {
+			t.Fatalf("expected %v but got %v", out, got)
+		}
+	}
+	for _, k := range server.keys() {
+		if !strings.HasPrefix(k, "test:salt-") {
+			t.Fatalf("key '%s' was not namespaced by prefix and salt", k)
+		}
+	}
+}
+
+func TestRedisCacheTTL(t *testing.T) {
+	server := newFakeRedis(t, "")
+	cache := NewRedis(server.addr(), WithTTL(20*time.Millisecond))
+	ctx := context.Background()
+	if err := cache.SetCachedResponse(ctx, "", redisTestInputs, jpf.AssistantMessage{Content: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(40 * time.Millisecond)
+	ok, _, err := cache.GetCachedResponse(ctx, "", redisTestInputs)
+	if err != nil || ok {
+		t.Fatalf("expected entry to have expired, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestRedisCacheUnavailable(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := lis.Addr().String()
+	lis.Close()
+	ctx := context.Background()
+
+	cache := NewRedis(addr)
+	if err := cache.SetCachedResponse(ctx, "", redisTestInputs, jpf.AssistantMessage{Content: "hi"}); err != nil {
+		t.Fatalf("expected set to degrade gracefully, got %v", err)
+	}
+	ok, _, err := cache.GetCachedResponse(ctx, "", redisTestInputs)
+	if err != nil || ok {
+		t.Fatalf("expected get to degrade to a miss, got ok=%v err=%v", ok, err)
+	}
+
+	strict := NewRedis(addr, WithStrictErrors())
+	_, _, err = strict.GetCachedResponse(ctx, "", redisTestInputs)
+	if !errors.Is(err, ErrRedisUnavailable) {
+		t.Fatalf("expected ErrRedisUnavailable, got %v", err)
+	}
+}
+
+func TestRedisCacheCancelledContext(t *testing.T) {
+	server := newFakeRedis(t, "")
+	cache := NewRedis(server.addr(), WithStrictErrors())
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := cache.GetCachedResponse(cancelled, "", redisTestInputs); err == nil {
+		t.Fatal("expected an error with a cancelled context")
+	}
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if err := cache.SetCachedResponse(expired, "", redisTestInputs, jpf.AssistantMessage{Content: "hi"}); err == nil {
+		t.Fatal("expected an error with an expired context")
+	}
+	// The server did nothing wrong, so it should not have been backed off from.
+	if err := cache.SetCachedResponse(context.Background(), "", redisTestInputs, jpf.AssistantMessage{Content: "hi"}); err != nil {
+		t.Fatalf("expected the server to still be used, got %v", err)
+	}
+}
+
+func TestRedisCacheReconnectsAfterIdleConnDropped(t *testing.T) {
+	server := newFakeRedis(t, "")
+	cache := NewRedis(server.addr(), WithStrictErrors())
+	ctx := context.Background()
+	if err := cache.SetCachedResponse(ctx, "", redisTestInputs, jpf.AssistantMessage{Content: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	server.dropConns()
+	ok, _, err := cache.GetCachedResponse(ctx, "", redisTestInputs)
+	if err != nil || !ok {
+		t.Fatalf("expected a hit on a fresh connection, got ok=%v err=%v", ok, err)
+	}
+	// The server never went down, so it should not have been backed off from.
+	if err := cache.SetCachedResponse(ctx, "", redisTestInputs, jpf.AssistantMessage{Content: "hi"}); err != nil {
+		t.Fatalf("expected the server to still be used, got %v", err)
+	}
+}
+
+func TestRedisCacheServerError(t *testing.T) {
+	server := newFakeRedis(t, "secret")
+	cache := NewRedis(server.addr(), WithPassword("wrong"))
+	_, _, err := cache.GetCachedResponse(context.Background(), "", redisTestInputs)
+	if err == nil {
+		t.Fatal("expected authentication error but got none")
+	}
+}
@@ -5,12 +5,17 @@ import (
 	"context"
 	"database/sql"
 	"encoding/gob"
+	"encoding/json"
 	"errors"
+	"time"
 
 	"github.com/JoshPattman/jpf"
 	"github.com/JoshPattman/jpf/internal/utils"
 )
 
+// NewSQL creates a ModelResponseCache that stores responses in the model_cache table of the given database.
+// The table is created if it does not exist, and older tables are migrated to also store the salt, input messages and creation time.
+// It implements [Inspectable].
 func NewSQL(ctx context.Context, db *sql.DB) (jpf.ModelResponseCache, error) {
 	c := &sqlCache{
 		db: db,
@@ -36,37 +41,170 @@ func (cache *sqlCache) GetCachedResponse(ctx context.Context, salt string, msgs
 	} else if err != nil {
 		return false, jpf.AssistantMessage{}, utils.Wrap(err, "failed to query database")
 	}
-	var output jpf.AssistantMessage
-	err = gob.NewDecoder(bytes.NewBuffer(blob)).Decode(&output)
+	output, err := decodeSQLResp(blob)
 	if err != nil {
-		return false, jpf.AssistantMessage{}, utils.Wrap(err, "failed to decode cached data")
+		return false, jpf.AssistantMessage{}, err
 	}
 	return true, output, nil
 }
 
 func (cache *sqlCache) SetCachedResponse(ctx context.Context, salt string, inputs []jpf.Message, out jpf.AssistantMessage) error {
-	h := HashMessages(salt, inputs)
+	return cache.AddEntries(ctx, []Entry{{Salt: salt, Inputs: inputs, Output: out, Created: time.Now()}})
+}
+
+// Entries implements Inspectable.
+func (cache *sqlCache) Entries(ctx context.Context) ([]Entry, error) {
+	rows, err := cache.db.QueryContext(ctx, `SELECT hash, resp, salt, inputs, created_at FROM model_cache ORDER BY created_at, hash;`)
+	if err != nil {
+		return nil, utils.Wrap(err, "failed to query database")
+	}
+	defer rows.Close()
+	entries := []Entry{}
+	for rows.Next() {
+		var hash, salt, inputsJson string
+		var blob []byte
+		var created int64
+		if err := rows.Scan(&hash, &blob, &salt, &inputsJson, &created); err != nil {
+			return nil, utils.Wrap(err, "failed to scan row")
+		}
+		output, err := decodeSQLResp(blob)
+		if err != nil {
+			return nil, err
+		}
+		var inputs []jpf.Message
+		if inputsJson != "" {
+			var jsonMsgs []utils.JsonMessage
+			if err := json.Unmarshal([]byte(inputsJson), &jsonMsgs); err != nil {
+				return nil, utils.Wrap(err, "failed to decode input messages")
+			}
+			inputs, err = utils.MessagesFromJson(jsonMsgs)
+			if err != nil {
+				return nil, utils.Wrap(err, "failed to decode input messages")
+			}
+		}
+		entry := Entry{Hash: hash, Salt: salt, Inputs: inputs, Output: output}
+		if created != 0 {
+			entry.Created = time.Unix(created, 0)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utils.Wrap(err, "failed to read rows")
+	}
+	return entries, nil
+}
+
+// AddEntries implements Inspectable.
+func (cache *sqlCache) AddEntries(ctx context.Context, entries []Entry) error {
+	tx, err := cache.db.BeginTx(ctx, nil)
+	if err != nil {
+		return utils.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+	for _, entry := range entries {
+		if err := addSQLEntry(ctx, tx, entry); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return utils.Wrap(err, "failed to commit transaction")
+	}
+	return nil
+}
+
+func addSQLEntry(ctx context.Context, tx *sql.Tx, entry Entry) error {
+	h := entry.Hash
+	if h == "" {
+		h = HashMessages(entry.Salt, entry.Inputs)
+	}
 	blob := bytes.NewBuffer(nil)
-	err := gob.NewEncoder(blob).Encode(out)
+	err := gob.NewEncoder(blob).Encode(entry.Output)
 	if err != nil {
 		return utils.Wrap(err, "failed to encode messages to binary data")
 	}
-	_, err = cache.db.ExecContext(ctx, `INSERT INTO model_cache (hash, resp) VALUES (?, ?) ON CONFLICT(hash) DO UPDATE SET resp = excluded.resp;`, h, blob.Bytes())
+	jsonMsgs, err := utils.MessagesToJson(entry.Inputs)
+	if err != nil {
+		return utils.Wrap(err, "failed to encode input messages")
+	}
+	inputs, err := json.Marshal(jsonMsgs)
+	if err != nil {
+		return utils.Wrap(err, "failed to encode input messages")
+	}
+	var created int64
+	if !entry.Created.IsZero() {
+		created = entry.Created.Unix()
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO model_cache (hash, resp, salt, inputs, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(hash) DO UPDATE SET resp = excluded.resp, salt = excluded.salt, inputs = excluded.inputs, created_at = excluded.created_at;`,
+		h, blob.Bytes(), entry.Salt, string(inputs), created,
+	)
 	if err != nil {
 		return utils.Wrap(err, "failed to execute database insert")
 	}
 	return nil
 }
 
+// DeleteEntries implements Inspectable.
+func (cache *sqlCache) DeleteEntries(ctx context.Context, hashes []string) error {
+	tx, err := cache.db.BeginTx(ctx, nil)
+	if err != nil {
+		return utils.Wrap(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+	for _, h := range hashes {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM model_cache WHERE hash=?;`, h); err != nil {
+			return utils.Wrap(err, "failed to execute database delete")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return utils.Wrap(err, "failed to commit transaction")
+	}
+	return nil
+}
+
 func (cache *sqlCache) setupDB(ctx context.Context) error {
 	query := `
 	CREATE TABLE IF NOT EXISTS model_cache (
 		hash TEXT PRIMARY KEY,
-		resp BLOB NOT NULL
+		resp BLOB NOT NULL,
+		salt TEXT NOT NULL DEFAULT '',
+		inputs TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL DEFAULT 0
 	);`
 	_, err := cache.db.ExecContext(ctx, query)
 	if err != nil {
 		return utils.Wrap(err, "failed to create model cache table")
 	}
+	return cache.migrateDB(ctx)
+}
+
+// migrateDB adds the columns introduced after the first version of the table, if they are missing.
+func (cache *sqlCache) migrateDB(ctx context.Context) error {
+	rows, err := cache.db.QueryContext(ctx, `SELECT salt, inputs, created_at FROM model_cache LIMIT 0;`)
+	if err == nil {
+		rows.Close()
+		return nil
+	}
+	migrations := []string{
+		`ALTER TABLE model_cache ADD COLUMN salt TEXT NOT NULL DEFAULT '';`,
+		`ALTER TABLE model_cache ADD COLUMN inputs TEXT NOT NULL DEFAULT '';`,
+		`ALTER TABLE model_cache ADD COLUMN created_at INTEGER NOT NULL DEFAULT 0;`,
+	}
+	for _, m := range migrations {
+		if _, err := cache.db.ExecContext(ctx, m); err != nil {
+			return utils.Wrap(err, "failed to migrate model cache table")
+		}
+	}
 	return nil
 }
+
+func decodeSQLResp(blob []byte) (jpf.AssistantMessage, error) {
+	var output jpf.AssistantMessage
+	err := gob.NewDecoder(bytes.NewBuffer(blob)).Decode(&output)
+	if err != nil {
+		return jpf.AssistantMessage{}, utils.Wrap(err, "failed to decode cached data")
+	}
+	return output, nil
+}
@@ -0,0 +1,95 @@
+package caches
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/internal/utils"
+)
+
+// Entry is a single cached response, along with the request that produced it.
+// Entries written by older versions of the caches only have the Hash and Output set.
+type Entry struct {
+	Hash    string
+	Salt    string
+	Inputs  []jpf.Message
+	Output  jpf.AssistantMessage
+	Created time.Time
+}
+
+// Inspectable is a ModelResponseCache whose entries can be listed and maintained, for example by the jpfcache tool.
+// The RAM, file and SQL caches all implement it.
+type Inspectable interface {
+	jpf.ModelResponseCache
+	// List all entries in the cache.
+	Entries(ctx context.Context) ([]Entry, error)
+	// Add the entries to the cache, overwriting any entries with the same hashes.
+	// If the hash of an entry is empty, it is computed from its salt and inputs.
+	AddEntries(ctx context.Context, entries []Entry) error
+	// Delete the entries with the given hashes. Hashes that are not present are ignored.
+	DeleteEntries(ctx context.Context, hashes []string) error
+}
+
+func packetFromEntry(entry Entry) (string, memoryCachePacket, error) {
+	inputs, err := utils.MessagesToJson(entry.Inputs)
+	if err != nil {
+		return "", memoryCachePacket{}, utils.Wrap(err, "failed to encode input messages")
+	}
+	hash := entry.Hash
+	if hash == "" {
+		hash = HashMessages(entry.Salt, entry.Inputs)
+	}
+	return hash, memoryCachePacket{
+		Final:   entry.Output,
+		Salt:    entry.Salt,
+		Inputs:  inputs,
+		Created: entry.Created,
+	}, nil
+}
+
+func packetsFromEntries(entries []Entry) (map[string]memoryCachePacket, error) {
+	packets := make(map[string]memoryCachePacket, len(entries))
+	for _, entry := range entries {
+		hash, packet, err := packetFromEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		packets[hash] = packet
+	}
+	return packets, nil
+}
+
+func (p memoryCachePacket) entry(hash string) (Entry, error) {
+	inputs, err := utils.MessagesFromJson(p.Inputs)
+	if err != nil {
+		return Entry{}, utils.Wrap(err, "failed to decode input messages")
+	}
+	return Entry{
+		Hash:    hash,
+		Salt:    p.Salt,
+		Inputs:  inputs,
+		Output:  p.Final,
+		Created: p.Created,
+	}, nil
+}
+
+func packetsToEntries(packets map[string]memoryCachePacket) ([]Entry, error) {
+	entries := make([]Entry, 0, len(packets))
+	for hash, p := range packets {
+		e, err := p.entry(hash)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b Entry) int {
+		if c := a.Created.Compare(b.Created); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Hash, b.Hash)
+	})
+	return entries, nil
+}
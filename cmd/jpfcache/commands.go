@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/caches"
+)
+
+func cmdList(ctx context.Context, cache caches.Inspectable, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	salt := fs.String("salt", "", "Only list entries with this salt")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	entries, err := filteredEntries(ctx, cache, saltFilter(fs, *salt))
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "HASH\tSALT\tCREATED\tINPUTS\tLAST INPUT\tOUTPUT")
+	for _, e := range entries {
+		lastInput := "?"
+		if len(e.Inputs) > 0 {
+			lastInput = preview(messageText(e.Inputs[len(e.Inputs)-1]), 40)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Hash[:min(12, len(e.Hash))],
+			e.Salt,
+			formatCreated(e.Created),
+			formatInputCount(e),
+			lastInput,
+			preview(e.Output.Content, 40),
+		)
+	}
+	return w.Flush()
+}
+
+func cmdShow(ctx context.Context, cache caches.Inspectable, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: show <hash prefix>")
+	}
+	entries, err := filteredEntries(ctx, cache, func(e caches.Entry) bool { return strings.HasPrefix(e.Hash, args[0]) })
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no entry has a hash starting with '%s'", args[0])
+	} else if len(entries) > 1 {
+		return fmt.Errorf("%d entries have a hash starting with '%s', be more specific", len(entries), args[0])
+	}
+	e := entries[0]
+	fmt.Printf("Hash:    %s\nSalt:    %s\nCreated: %s\n", e.Hash, e.Salt, formatCreated(e.Created))
+	if len(e.Inputs) == 0 {
+		fmt.Println("\n(input messages were not stored for this entry)")
+	}
+	for _, msg := range e.Inputs {
+		printMessage(msg)
+	}
+	printMessage(e.Output)
+	return nil
+}
+
+func cmdDelete(ctx context.Context, cache caches.Inspectable, args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	salt := fs.String("salt", "", "Delete entries with this salt")
+	olderThan := fs.Duration("older-than", 0, "Delete entries created more than this long ago (entries with unknown age are kept)")
+	hash := fs.String("hash", "", "Delete the entry whose hash starts with this prefix")
+	dryRun := fs.Bool("n", false, "Only print what would be deleted")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	saltSet := flagWasSet(fs, "salt")
+	if !saltSet && *olderThan == 0 && *hash == "" {
+		return errors.New("at least one of -salt, -older-than or -hash must be specified")
+	}
+	cutoff := time.Now().Add(-*olderThan)
+	entries, err := filteredEntries(ctx, cache, func(e caches.Entry) bool {
+		if saltSet && e.Salt != *salt {
+			return false
+		}
+		if *olderThan != 0 && (e.Created.IsZero() || e.Created.After(cutoff)) {
+			return false
+		}
+		if *hash != "" && !strings.HasPrefix(e.Hash, *hash) {
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	hashes := make([]string, len(entries))
+	for i, e := range entries {
+		hashes[i] = e.Hash
+	}
+	if *dryRun {
+		for _, h := range hashes {
+			fmt.Println(h)
+		}
+		fmt.Printf("would delete %d entries\n", len(hashes))
+		return nil
+	}
+	if err := cache.DeleteEntries(ctx, hashes); err != nil {
+		return err
+	}
+	fmt.Printf("deleted %d entries\n", len(hashes))
+	return nil
+}
+
+func cmdExport(ctx context.Context, cache caches.Inspectable, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	salt := fs.String("salt", "", "Only export entries with this salt")
+	out := fs.String("o", "", "The file to write to (default stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	entries, err := filteredEntries(ctx, cache, saltFilter(fs, *salt))
+	if err != nil {
+		return err
+	}
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, e := range entries {
+		je, err := entryToJsonl(e)
+		if err != nil {
+			return fmt.Errorf("failed to convert entry %s: %w", e.Hash, err)
+		}
+		if err := enc.Encode(je); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func cmdImport(ctx context.Context, cache caches.Inspectable, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: import <file>")
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64*1024*1024)
+	entries := []caches.Entry{}
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var je jsonlEntry
+		if err := json.Unmarshal(scanner.Bytes(), &je); err != nil {
+			return fmt.Errorf("failed to decode line %d: %w", lineNum, err)
+		}
+		e, err := entryFromJsonl(je)
+		if err != nil {
+			return fmt.Errorf("failed to convert line %d: %w", lineNum, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := cache.AddEntries(ctx, entries); err != nil {
+		return fmt.Errorf("failed to add entries: %w", err)
+	}
+	fmt.Printf("imported %d entries\n", len(entries))
+	return nil
+}
+
+func cmdMerge(ctx context.Context, cache caches.Inspectable, args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ContinueOnError)
+	overwrite := fs.Bool("overwrite", false, "Overwrite entries that already exist in this cache")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: merge [-overwrite] <other cache>")
+	}
+	other, closeOther, err := openCache(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer closeOther()
+	existing, err := cache.Entries(ctx)
+	if err != nil {
+		return err
+	}
+	existingHashes := make(map[string]bool, len(existing))
+	for _, e := range existing {
+		existingHashes[e.Hash] = true
+	}
+	entries, err := other.Entries(ctx)
+	if err != nil {
+		return err
+	}
+	added := slices.DeleteFunc(entries, func(e caches.Entry) bool { return existingHashes[e.Hash] && !*overwrite })
+	skipped := len(entries) - len(added)
+	if err := cache.AddEntries(ctx, added); err != nil {
+		return fmt.Errorf("failed to add entries: %w", err)
+	}
+	fmt.Printf("merged %d entries (%d skipped as already present)\n", len(added), skipped)
+	return nil
+}
+
+func cmdStats(ctx context.Context, cache caches.Inspectable, spec string) error {
+	entries, err := cache.Entries(ctx)
+	if err != nil {
+		return err
+	}
+	type saltStats struct {
+		entries, inputBytes, outputBytes int
+	}
+	bySalt := map[string]*saltStats{}
+	legacy := 0
+	var oldest, newest time.Time
+	for _, e := range entries {
+		s, ok := bySalt[e.Salt]
+		if !ok {
+			s = &saltStats{}
+			bySalt[e.Salt] = s
+		}
+		s.entries++
+		for _, msg := range e.Inputs {
+			s.inputBytes += len(messageText(msg))
+		}
+		s.outputBytes += len(e.Output.Content)
+		if len(e.Inputs) == 0 {
+			legacy++
+		}
+		if !e.Created.IsZero() {
+			if oldest.IsZero() || e.Created.Before(oldest) {
+				oldest = e.Created
+			}
+			if e.Created.After(newest) {
+				newest = e.Created
+			}
+		}
+	}
+	_, path := parseCacheSpec(spec)
+	if info, err := os.Stat(path); err == nil {
+		fmt.Printf("File:            %s (%s)\n", filepath.Base(path), formatBytes(int(info.Size())))
+	}
+	fmt.Printf("Entries:         %d\n", len(entries))
+	fmt.Printf("Without inputs:  %d\n", legacy)
+	fmt.Printf("Oldest:          %s\n", formatCreated(oldest))
+	fmt.Printf("Newest:          %s\n", formatCreated(newest))
+	fmt.Println()
+	salts := make([]string, 0, len(bySalt))
+	for salt := range bySalt {
+		salts = append(salts, salt)
+	}
+	slices.Sort(salts)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SALT\tENTRIES\tINPUT TEXT\tOUTPUT TEXT")
+	for _, salt := range salts {
+		s := bySalt[salt]
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", salt, s.entries, formatBytes(s.inputBytes), formatBytes(s.outputBytes))
+	}
+	return w.Flush()
+}
+
+func filteredEntries(ctx context.Context, cache caches.Inspectable, keep func(caches.Entry) bool) ([]caches.Entry, error) {
+	entries, err := cache.Entries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(entries, func(e caches.Entry) bool { return !keep(e) }), nil
+}
+
+// saltFilter keeps entries with the given salt, or all entries if the salt flag was not set (so that an empty salt can be filtered on).
+func saltFilter(fs *flag.FlagSet, salt string) func(caches.Entry) bool {
+	if !flagWasSet(fs, "salt") {
+		return func(caches.Entry) bool { return true }
+	}
+	return func(e caches.Entry) bool { return e.Salt == salt }
+}
+
+func flagWasSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func printMessage(msg jpf.Message) {
+	role := "?"
+	extra := ""
+	switch msg := msg.(type) {
+	case jpf.UserMessage:
+		role = "user"
+		if len(msg.Images) > 0 {
+			extra = fmt.Sprintf(" (%d images)", len(msg.Images))
+		}
+	case jpf.AssistantMessage:
+		role = "assistant"
+		for _, tc := range msg.ToolCalls {
+			args, _ := json.Marshal(tc.Args)
+			extra += fmt.Sprintf("\n  tool call %s: %s(%s)", tc.ID, tc.Tool, args)
+		}
+	case jpf.DeveloperMessage:
+		role = "developer"
+	case jpf.SystemMessage:
+		role = "system"
+	case jpf.ToolResultMessage:
+		role = "tool result for " + msg.CallID
+	}
+	fmt.Printf("\n--- %s%s\n%s\n", role, extra, messageText(msg))
+}
+
+func messageText(msg jpf.Message) string {
+	switch msg := msg.(type) {
+	case jpf.UserMessage:
+		return msg.Content
+	case jpf.AssistantMessage:
+		return msg.Content
+	case jpf.DeveloperMessage:
+		return msg.Content
+	case jpf.SystemMessage:
+		return msg.Content
+	case jpf.ToolResultMessage:
+		return msg.Result
+	default:
+		return ""
+	}
+}
+
+func preview(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len([]rune(s)) > n {
+		return string([]rune(s)[:n-3]) + "..."
+	}
+	return s
+}
+
+func formatInputCount(e caches.Entry) string {
+	if len(e.Inputs) == 0 {
+		return "?"
+	}
+	return fmt.Sprint(len(e.Inputs))
+}
+
+func formatCreated(t time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+	return t.Local().Format(time.DateTime)
+}
+
+func formatBytes(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
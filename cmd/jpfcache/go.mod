@@ -0,0 +1,10 @@
+module github.com/JoshPattman/jpf/cmd/jpfcache
+
+go 1.24.0
+
+require (
+	github.com/JoshPattman/jpf v0.10.0
+	github.com/mattn/go-sqlite3 v1.14.32
+)
+
+replace github.com/JoshPattman/jpf => ../..
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/caches"
+	"github.com/JoshPattman/jpf/internal/utils"
+)
+
+// jsonlEntry is the format of each line of an exported cache.
+type jsonlEntry struct {
+	Hash    string              `json:"hash"`
+	Salt    string              `json:"salt"`
+	Created *time.Time          `json:"created,omitempty"`
+	Inputs  []utils.JsonMessage `json:"inputs"`
+	Output  utils.JsonMessage   `json:"output"`
+}
+
+func entryToJsonl(e caches.Entry) (jsonlEntry, error) {
+	inputs, err := utils.MessagesToJson(e.Inputs)
+	if err != nil {
+		return jsonlEntry{}, err
+	}
+	output, err := utils.MessageToJson(e.Output)
+	if err != nil {
+		return jsonlEntry{}, err
+	}
+	je := jsonlEntry{
+		Hash:   e.Hash,
+		Salt:   e.Salt,
+		Inputs: inputs,
+		Output: output,
+	}
+	if !e.Created.IsZero() {
+		je.Created = &e.Created
+	}
+	return je, nil
+}
+
+func entryFromJsonl(je jsonlEntry) (caches.Entry, error) {
+	inputs, err := utils.MessagesFromJson(je.Inputs)
+	if err != nil {
+		return caches.Entry{}, err
+	}
+	output, err := utils.MessageFromJson(je.Output)
+	if err != nil {
+		return caches.Entry{}, err
+	}
+	asst, ok := output.(jpf.AssistantMessage)
+	if !ok {
+		return caches.Entry{}, fmt.Errorf("output had role '%s', expected 'assistant'", je.Output.Role)
+	}
+	e := caches.Entry{
+		Hash:   je.Hash,
+		Salt:   je.Salt,
+		Inputs: inputs,
+		Output: asst,
+	}
+	if je.Created != nil {
+		e.Created = *je.Created
+	}
+	return e, nil
+}
@@ -0,0 +1,75 @@
+// Command jpfcache inspects and maintains jpf model response caches.
+//
+// It works with caches created by caches.NewFile (gob files) and caches.NewSQL (the model_cache table of a sqlite database).
+// The cache is chosen with the -cache flag, which takes a path optionally prefixed with "file:" or "sqlite:".
+// Without a prefix, paths ending in .db, .sqlite or .sqlite3 are treated as sqlite databases, and all other paths as gob files.
+//
+// Usage:
+//
+//	jpfcache -cache <cache> <command> [args]
+//
+// Commands:
+//
+//	list    [-salt s]                                list entries
+//	show    <hash prefix>                            show the decoded messages of an entry
+//	delete  [-salt s] [-older-than d] [-hash h] [-n]  delete matching entries
+//	export  [-salt s] [-o file]                      export entries as JSONL (default stdout)
+//	import  <file>                                   import entries from JSONL
+//	merge   [-overwrite] <other cache>               copy entries from another cache into this one
+//	stats                                            report size statistics
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	if err := run(context.Background(), os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "jpfcache:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("jpfcache", flag.ContinueOnError)
+	cacheSpec := fs.String("cache", "", "The cache to operate on (file:<path> or sqlite:<path>)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: jpfcache -cache <cache> <list|show|delete|export|import|merge|stats> [args]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *cacheSpec == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("a cache and a command must be specified")
+	}
+	cache, closeCache, err := openCache(ctx, *cacheSpec)
+	if err != nil {
+		return err
+	}
+	defer closeCache()
+
+	cmd, cmdArgs := fs.Arg(0), fs.Args()[1:]
+	switch cmd {
+	case "list":
+		return cmdList(ctx, cache, cmdArgs)
+	case "show":
+		return cmdShow(ctx, cache, cmdArgs)
+	case "delete":
+		return cmdDelete(ctx, cache, cmdArgs)
+	case "export":
+		return cmdExport(ctx, cache, cmdArgs)
+	case "import":
+		return cmdImport(ctx, cache, cmdArgs)
+	case "merge":
+		return cmdMerge(ctx, cache, cmdArgs)
+	case "stats":
+		return cmdStats(ctx, cache, *cacheSpec)
+	default:
+		return fmt.Errorf("unknown command '%s'", cmd)
+	}
+}
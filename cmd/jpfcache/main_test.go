@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/caches"
+)
+
+// runJpfcache runs the tool with the arguments, returning what it printed.
+func runJpfcache(t *testing.T, args ...string) string {
+	t.Helper()
+	out, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	stdout := os.Stdout
+	os.Stdout = out
+	err = run(context.Background(), args)
+	os.Stdout = stdout
+	if err != nil {
+		t.Fatalf("jpfcache %s: %v", strings.Join(args, " "), err)
+	}
+	data, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// seedCache adds the entries to the cache described by the spec.
+func seedCache(t *testing.T, spec string, entries ...caches.Entry) {
+	t.Helper()
+	cache, closeCache, err := openCache(context.Background(), spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeCache()
+	if err := cache.AddEntries(context.Background(), entries); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testEntry(salt, input string, created time.Time) caches.Entry {
+	return caches.Entry{
+		Salt:    salt,
+		Inputs:  []jpf.Message{jpf.UserMessage{Content: input}},
+		Output:  jpf.AssistantMessage{Content: strings.ToUpper(input)},
+		Created: created,
+	}
+}
+
+func expectOutput(t *testing.T, output string, contains []string, excludes []string) {
+	t.Helper()
+	for _, s := range contains {
+		if !strings.Contains(output, s) {
+			t.Fatalf("expected output to contain %q, got:\n%s", s, output)
+		}
+	}
+	for _, s := range excludes {
+		if strings.Contains(output, s) {
+			t.Fatalf("expected output not to contain %q, got:\n%s", s, output)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	for _, kind := range []string{"file", "sqlite"} {
+		t.Run(kind, func(t *testing.T) {
+			dir := t.TempDir()
+			spec := kind + ":" + filepath.Join(dir, "cache")
+			old := testEntry("a", "hello", time.Now().Add(-48*time.Hour))
+			seedCache(t, spec, old, testEntry("a", "world", time.Now()), testEntry("b", "bye", time.Now()))
+
+			expectOutput(t, runJpfcache(t, "-cache", spec, "list"), []string{"hello", "WORLD", "bye"}, nil)
+			expectOutput(t, runJpfcache(t, "-cache", spec, "list", "-salt", "b"), []string{"bye"}, []string{"hello", "world"})
+			hash := caches.HashMessages(old.Salt, old.Inputs)
+			expectOutput(t, runJpfcache(t, "-cache", spec, "show", hash[:8]), []string{hash, "--- user\nhello", "--- assistant\nHELLO"}, nil)
+			expectOutput(t, runJpfcache(t, "-cache", spec, "stats"), []string{"Entries:         3", "a     2"}, nil)
+
+			expectOutput(t, runJpfcache(t, "-cache", spec, "delete", "-older-than", "24h", "-n"), []string{hash, "would delete 1 entries"}, nil)
+			expectOutput(t, runJpfcache(t, "-cache", spec, "delete", "-older-than", "24h"), []string{"deleted 1 entries"}, nil)
+			expectOutput(t, runJpfcache(t, "-cache", spec, "list"), []string{"world", "bye"}, []string{"hello"})
+
+			export := filepath.Join(dir, "export.jsonl")
+			runJpfcache(t, "-cache", spec, "export", "-salt", "a", "-o", export)
+			expectOutput(t, runJpfcache(t, "-cache", spec, "delete", "-salt", "a"), []string{"deleted 1 entries"}, nil)
+			expectOutput(t, runJpfcache(t, "-cache", spec, "import", export), []string{"imported 1 entries"}, nil)
+			expectOutput(t, runJpfcache(t, "-cache", spec, "list", "-salt", "a"), []string{"world"}, nil)
+
+			other := "file:" + filepath.Join(dir, "other.gob")
+			seedCache(t, other, testEntry("a", "world", time.Now()), testEntry("c", "new", time.Now()))
+			expectOutput(t, runJpfcache(t, "-cache", spec, "merge", other), []string{"merged 1 entries (1 skipped as already present)"}, nil)
+			expectOutput(t, runJpfcache(t, "-cache", spec, "stats"), []string{"Entries:         3"}, nil)
+		})
+	}
+}
+
+func TestSQLiteMigratesLegacyTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`CREATE TABLE model_cache (hash TEXT PRIMARY KEY, resp BLOB NOT NULL);`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	seedCache(t, path, testEntry("a", "hello", time.Now()))
+	expectOutput(t, runJpfcache(t, "-cache", path, "list"), []string{"hello", "HELLO"}, nil)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/JoshPattman/jpf/caches"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openCache opens the cache described by the spec, returning it along with a function to release its resources.
+func openCache(ctx context.Context, spec string) (caches.Inspectable, func(), error) {
+	kind, path := parseCacheSpec(spec)
+	switch kind {
+	case "file":
+		cache, err := caches.NewFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open file cache: %w", err)
+		}
+		return cache.(caches.Inspectable), func() {}, nil
+	case "sqlite":
+		db, err := sql.Open("sqlite3", path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open sqlite database: %w", err)
+		}
+		cache, err := caches.NewSQL(ctx, db)
+		if err != nil {
+			db.Close()
+			return nil, nil, fmt.Errorf("failed to open sql cache: %w", err)
+		}
+		return cache.(caches.Inspectable), func() { db.Close() }, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown cache kind '%s'", kind)
+	}
+}
+
+func parseCacheSpec(spec string) (string, string) {
+	if kind, path, ok := strings.Cut(spec, ":"); ok && (kind == "file" || kind == "sqlite") {
+		return kind, path
+	}
+	switch filepath.Ext(spec) {
+	case ".db", ".sqlite", ".sqlite3":
+		return "sqlite", spec
+	default:
+		return "file", spec
+	}
+}
@@ -0,0 +1,25 @@
+package feedbacks
+
+import (
+	"strings"
+
+	"github.com/JoshPattman/jpf"
+)
+
+// NewBulletPoints creates a FeedbackGenerator that lists each problem with the response as a bullet point,
+// such as each schema violation found by a validating parser, and asks the model to fix all of them.
+func NewBulletPoints() jpf.FeedbackGenerator {
+	return &bulletPointsFG{}
+}
+
+type bulletPointsFG struct{}
+
+func (g *bulletPointsFG) FormatFeedback(_ jpf.AssistantMessage, err error) string {
+	b := &strings.Builder{}
+	b.WriteString("Your response had the following problems:\n")
+	for _, p := range problems(err) {
+		b.WriteString("- " + p + "\n")
+	}
+	b.WriteString("Fix all of them and respond again.")
+	return b.String()
+}
@@ -0,0 +1,63 @@
+package feedbacks
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/JoshPattman/jpf"
+)
+
+// NewEscalating creates a FeedbackGenerator that uses the base generator, but adds stronger instructions once the model has failed after attempts.
+// This needs the attempt number, so has no effect in pipelines that do not provide it.
+func NewEscalating(base jpf.FeedbackGenerator, after int, opts ...EscalatingOpt) jpf.FeedbackGenerator {
+	g := &escalatingFG{
+		base:  base,
+		after: after,
+		message: "You have now given %d invalid responses. " +
+			"Read the instructions again carefully, and make sure your response follows the required format exactly.",
+	}
+	for _, o := range opts {
+		o(g)
+	}
+	return g
+}
+
+type EscalatingOpt func(*escalatingFG)
+
+// Use a custom escalation message. If it contains %d, it is replaced with the number of failed attempts.
+func WithEscalationMessage(message string) EscalatingOpt {
+	return func(g *escalatingFG) { g.message = message }
+}
+
+// Also show an example of a valid response once escalated.
+func WithExample(example string) EscalatingOpt {
+	return func(g *escalatingFG) { g.example = example }
+}
+
+type escalatingFG struct {
+	base    jpf.FeedbackGenerator
+	after   int
+	message string
+	example string
+}
+
+func (g *escalatingFG) FormatFeedback(msg jpf.AssistantMessage, err error) string {
+	return g.base.FormatFeedback(msg, err)
+}
+
+func (g *escalatingFG) FormatAttemptFeedback(msg jpf.AssistantMessage, err error, attempt int) string {
+	var feedback string
+	if ag, ok := g.base.(jpf.AttemptFeedbackGenerator); ok {
+		feedback = ag.FormatAttemptFeedback(msg, err, attempt)
+	} else {
+		feedback = g.base.FormatFeedback(msg, err)
+	}
+	if attempt < g.after {
+		return feedback
+	}
+	feedback += "\n\n" + strings.ReplaceAll(g.message, "%d", strconv.Itoa(attempt))
+	if g.example != "" {
+		feedback += "\nHere is an example of a valid response:\n" + g.example
+	}
+	return feedback
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/JoshPattman/jpf"
 	"github.com/JoshPattman/jpf/internal/utils"
+	"github.com/JoshPattman/jpf/validators"
 )
 
 type FGCase struct {
@@ -14,7 +15,9 @@ type FGCase struct {
 	Build        func() jpf.FeedbackGenerator
 	InputMessage jpf.AssistantMessage
 	InputError   error
-	Expected     string
+	// If non-zero, the attempt is passed to generators that accept it.
+	Attempt  int
+	Expected string
 }
 
 func (testCase FGCase) Name() string { return testCase.ID }
@@ -22,12 +25,53 @@ func (testCase FGCase) Name() string { return testCase.ID }
 func (testCase FGCase) Test() error {
 	rd := testCase.Build()
 	result := rd.FormatFeedback(testCase.InputMessage, testCase.InputError)
+	if ag, ok := rd.(jpf.AttemptFeedbackGenerator); ok && testCase.Attempt != 0 {
+		result = ag.FormatAttemptFeedback(testCase.InputMessage, testCase.InputError, testCase.Attempt)
+	}
 	if result != testCase.Expected {
 		return errors.Join(fmt.Errorf("expected and observed did not match. Expected %v but got %v", testCase.Expected, result))
 	}
 	return nil
 }
 
+var testingSchemaError = utils.Wrap(
+	errors.Join(
+		errors.New("at 'label': the string \"meh\" is not one of the allowed values [\"positive\", \"negative\"]"),
+		errors.New("missing required field 'score'"),
+		jpf.ErrInvalidResponse,
+	),
+	"llm returned json that did not match the schema",
+)
+
+type testingValidatedOutput struct {
+	Summary string  `json:"summary" validate:"required"`
+	Score   float64 `json:"score" validate:"max=1"`
+}
+
+// testingValidatorError is a validator error, wrapped in the same way as by a pipeline.
+var testingValidatorError = utils.Wrap(
+	validators.NewStruct[string, testingValidatedOutput]().ValidateParsedResponse("", testingValidatedOutput{Score: 2}),
+	"failed to validate model response",
+)
+
+var testingSchemaResponse = jpf.AssistantMessage{Content: "{\n  \"label\": \"meh\"\n}"}
+
+func buildTestingTemplate() jpf.FeedbackGenerator {
+	return NewTemplate("Attempt {{.Attempt}} failed:{{range .Problems}}\n* {{.}}{{end}}")
+}
+
+func buildTestingQuoting() jpf.FeedbackGenerator {
+	return NewQuoting(10)
+}
+
+func buildTestingUnlimitedQuoting() jpf.FeedbackGenerator {
+	return NewQuoting(0)
+}
+
+func buildTestingEscalating() jpf.FeedbackGenerator {
+	return NewEscalating(NewBulletPoints(), 3, WithEscalationMessage("Strike %d."), WithExample(`{"label": "positive", "score": 1}`))
+}
+
 var FGCases = []utils.TestCase{
 	FGCase{
 		ID:           "rawmessage/errormessage",
@@ -36,6 +80,87 @@ var FGCases = []utils.TestCase{
 		InputError:   errors.New("abcdef"),
 		Expected:     "abcdef",
 	},
+	FGCase{
+		ID:           "template/problems",
+		Build:        buildTestingTemplate,
+		InputMessage: testingSchemaResponse,
+		InputError:   testingSchemaError,
+		Attempt:      2,
+		Expected: "Attempt 2 failed:\n" +
+			"* at 'label': the string \"meh\" is not one of the allowed values [\"positive\", \"negative\"]\n" +
+			"* missing required field 'score'",
+	},
+	FGCase{
+		ID:           "bullets/schema",
+		Build:        NewBulletPoints,
+		InputMessage: testingSchemaResponse,
+		InputError:   testingSchemaError,
+		Expected: "Your response had the following problems:\n" +
+			"- at 'label': the string \"meh\" is not one of the allowed values [\"positive\", \"negative\"]\n" +
+			"- missing required field 'score'\n" +
+			"Fix all of them and respond again.",
+	},
+	FGCase{
+		ID:           "bullets/wrapped_validator",
+		Build:        NewBulletPoints,
+		InputMessage: jpf.AssistantMessage{Content: `{"summary": "", "score": 2}`},
+		InputError:   testingValidatorError,
+		Expected: "Your response had the following problems:\n" +
+			"- field 'summary' is required but was missing or empty\n" +
+			"- field 'score' must be at most 1 (got 2)\n" +
+			"Fix all of them and respond again.",
+	},
+	FGCase{
+		ID:           "bullets/wrapped_invalid_response",
+		Build:        NewBulletPoints,
+		InputMessage: jpf.AssistantMessage{Content: "no json here"},
+		InputError:   utils.Wrap(utils.Wrap(jpf.ErrInvalidResponse, "response did not contain a json object"), "failed to parse model response"),
+		Expected: "Your response had the following problems:\n" +
+			"- response did not contain a json object\n" +
+			"Fix all of them and respond again.",
+	},
+	FGCase{
+		ID:           "template/wrapped_invalid_response",
+		Build:        buildTestingTemplate,
+		InputMessage: jpf.AssistantMessage{Content: "no json here"},
+		InputError:   utils.Wrap(jpf.ErrInvalidResponse, "response did not contain a json object"),
+		Attempt:      1,
+		Expected:     "Attempt 1 failed:\n* response did not contain a json object",
+	},
+	FGCase{
+		ID:           "quoting/offending_line",
+		Build:        buildTestingUnlimitedQuoting,
+		InputMessage: testingSchemaResponse,
+		InputError:   testingSchemaError,
+		Expected: "In this part of your response:\n" +
+			"> \"label\": \"meh\"\n" +
+			"at 'label': the string \"meh\" is not one of the allowed values [\"positive\", \"negative\"]\n" +
+			"missing required field 'score'",
+	},
+	FGCase{
+		ID:           "quoting/whole_response",
+		Build:        buildTestingQuoting,
+		InputMessage: jpf.AssistantMessage{Content: "I am not sure what the answer is"},
+		InputError:   errors.Join(errors.New("response did not contain a json object"), jpf.ErrInvalidResponse),
+		Expected:     "In your response:\n> I am not s...\nresponse did not contain a json object",
+	},
+	FGCase{
+		ID:           "escalating/before",
+		Build:        buildTestingEscalating,
+		InputMessage: testingSchemaResponse,
+		InputError:   errors.Join(errors.New("bad"), jpf.ErrInvalidResponse),
+		Attempt:      2,
+		Expected:     "Your response had the following problems:\n- bad\nFix all of them and respond again.",
+	},
+	FGCase{
+		ID:           "escalating/after",
+		Build:        buildTestingEscalating,
+		InputMessage: testingSchemaResponse,
+		InputError:   errors.Join(errors.New("bad"), jpf.ErrInvalidResponse),
+		Attempt:      3,
+		Expected: "Your response had the following problems:\n- bad\nFix all of them and respond again.\n\n" +
+			"Strike 3.\nHere is an example of a valid response:\n{\"label\": \"positive\", \"score\": 1}",
+	},
 }
 
 func TestFeedbackGenerator(t *testing.T) {
@@ -0,0 +1,50 @@
+package feedbacks
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/internal/utils"
+)
+
+// problems splits an error into the individual problems it describes, one per line of the messages of its joined errors,
+// leaving out the lines added when errors are wrapped, and the generic [jpf.ErrInvalidResponse] message, which do not help the model.
+func problems(err error) []string {
+	ps := []string{}
+	for _, leaf := range leafErrors(err) {
+		for _, line := range strings.Split(leaf.Error(), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || line == jpf.ErrInvalidResponse.Error() || slices.Contains(ps, line) {
+				continue
+			}
+			ps = append(ps, line)
+		}
+	}
+	return ps
+}
+
+// leafErrors unwraps wrapped and joined errors, returning the errors that describe the problems.
+// The line added by wrapping is only left out if the wrapped error describes the problem itself,
+// as errors such as utils.Wrap(jpf.ErrInvalidResponse, ...) only describe the problem in that line.
+func leafErrors(err error) []error {
+	if err == nil {
+		return nil
+	}
+	if wrapped, ok := err.(*utils.WrappedError); ok {
+		leaves := slices.DeleteFunc(leafErrors(wrapped.Err), func(leaf error) bool { return leaf == jpf.ErrInvalidResponse })
+		if len(leaves) == 0 {
+			return []error{errors.New(wrapped.Msg)}
+		}
+		return leaves
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		leaves := []error{}
+		for _, e := range joined.Unwrap() {
+			leaves = append(leaves, leafErrors(e)...)
+		}
+		return leaves
+	}
+	return []error{err}
+}
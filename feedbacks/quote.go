@@ -0,0 +1,78 @@
+package feedbacks
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/JoshPattman/jpf"
+)
+
+// NewQuoting creates a FeedbackGenerator that quotes the offending part of the response alongside each problem.
+// The offending part is found by looking for the quoted values in the problem (such as "abc" in `the string "abc" does not match the pattern`)
+// and quoting the line of the response that contains them. Problems without a value found in the response are listed without a quote.
+// If no part of the response can be found, the start of the response is quoted instead, up to maxQuoteLength characters.
+func NewQuoting(maxQuoteLength int) jpf.FeedbackGenerator {
+	return &quotingFG{maxQuoteLength: maxQuoteLength}
+}
+
+type quotingFG struct {
+	maxQuoteLength int
+}
+
+var quotedValuePattern = regexp.MustCompile(`"(?:[^"\\]|\\.)*"|'[^']*'`)
+
+func (g *quotingFG) FormatFeedback(msg jpf.AssistantMessage, err error) string {
+	b := &strings.Builder{}
+	quoted := false
+	for _, p := range problems(err) {
+		if line, ok := offendingLine(msg.Content, p); ok {
+			b.WriteString("In this part of your response:\n" + quote(g.truncate(line)) + "\n")
+			quoted = true
+		}
+		b.WriteString(p + "\n")
+	}
+	if !quoted && strings.TrimSpace(msg.Content) != "" {
+		return "In your response:\n" + quote(g.truncate(msg.Content)) + "\n" + strings.TrimRight(b.String(), "\n")
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func (g *quotingFG) truncate(s string) string {
+	s = strings.TrimSpace(s)
+	r := []rune(s)
+	if g.maxQuoteLength > 0 && len(r) > g.maxQuoteLength {
+		return string(r[:g.maxQuoteLength]) + "..."
+	}
+	return s
+}
+
+// offendingLine finds the line of the response containing a value quoted in the problem.
+func offendingLine(response, problem string) (string, bool) {
+	for _, q := range quotedValuePattern.FindAllString(problem, -1) {
+		value := q[1 : len(q)-1]
+		if unquoted, err := strconv.Unquote(q); err == nil {
+			value = unquoted
+		}
+		if value == "" {
+			continue
+		}
+		i := strings.Index(response, value)
+		if i == -1 {
+			continue
+		}
+		start := strings.LastIndex(response[:i], "\n") + 1
+		end := strings.Index(response[i:], "\n")
+		if end == -1 {
+			end = len(response)
+		} else {
+			end += i
+		}
+		return response[start:end], true
+	}
+	return "", false
+}
+
+func quote(s string) string {
+	return "> " + strings.ReplaceAll(s, "\n", "\n> ")
+}
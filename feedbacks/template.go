@@ -0,0 +1,50 @@
+package feedbacks
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"github.com/JoshPattman/jpf"
+)
+
+// FeedbackData is the data available to the template of a template feedback generator.
+type FeedbackData struct {
+	// The content of the response that failed.
+	Response string
+	// Each problem with the response, without the generic invalid response message.
+	Problems []string
+	// The number of the attempt that failed, starting at 1 (or 0 if the pipeline does not provide it).
+	Attempt int
+}
+
+// NewTemplate creates a FeedbackGenerator that formats feedback using Go's text/template, with [FeedbackData] as the data.
+// For example: "Attempt {{.Attempt}} was invalid:{{range .Problems}}\n- {{.}}{{end}}".
+// It panics if the template cannot be parsed.
+func NewTemplate(feedbackTemplate string) jpf.FeedbackGenerator {
+	return &templateFG{
+		template: template.Must(template.New("feedback").Parse(feedbackTemplate)),
+	}
+}
+
+type templateFG struct {
+	template *template.Template
+}
+
+func (g *templateFG) FormatFeedback(msg jpf.AssistantMessage, err error) string {
+	return g.FormatAttemptFeedback(msg, err, 0)
+}
+
+func (g *templateFG) FormatAttemptFeedback(msg jpf.AssistantMessage, err error, attempt int) string {
+	data := FeedbackData{
+		Response: msg.Content,
+		Problems: problems(err),
+		Attempt:  attempt,
+	}
+	buf := &bytes.Buffer{}
+	if execErr := g.template.Execute(buf, data); execErr != nil {
+		// The feedback must still be useful, so fall back to listing the problems
+		return strings.Join(data.Problems, "\n")
+	}
+	return buf.String()
+}
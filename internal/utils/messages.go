@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"strings"
+
+	"github.com/JoshPattman/jpf"
+)
+
+// JsonMessage is a human-readable json representation of a [jpf.Message] that can be converted back to the original message.
+type JsonMessage struct {
+	Role      string         `json:"role"`
+	Content   string         `json:"content"`
+	Images    []string       `json:"images,omitempty"`
+	ToolCalls []JsonToolCall `json:"tool_calls,omitempty"`
+	CallID    string         `json:"call_id,omitempty"`
+}
+
+type JsonToolCall struct {
+	ID   string         `json:"id"`
+	Tool string         `json:"tool"`
+	Args map[string]any `json:"args"`
+}
+
+func MessageToJson(msg jpf.Message) (JsonMessage, error) {
+	switch msg := msg.(type) {
+	case jpf.UserMessage:
+		images := make([]string, len(msg.Images))
+		for i, img := range msg.Images {
+			enc, err := img.ToBase64Encoded(false)
+			if err != nil {
+				return JsonMessage{}, Wrap(err, "failed to encode image")
+			}
+			images[i] = enc
+		}
+		return JsonMessage{Role: "user", Content: msg.Content, Images: images}, nil
+	case jpf.AssistantMessage:
+		return JsonMessage{Role: "assistant", Content: msg.Content, ToolCalls: ToolCallsToJson(msg.ToolCalls)}, nil
+	case jpf.DeveloperMessage:
+		return JsonMessage{Role: "developer", Content: msg.Content}, nil
+	case jpf.SystemMessage:
+		return JsonMessage{Role: "system", Content: msg.Content}, nil
+	case jpf.ToolResultMessage:
+		return JsonMessage{Role: "tool", Content: msg.Result, CallID: msg.CallID}, nil
+	default:
+		panic("unreachable")
+	}
+}
+
+func MessageFromJson(msg JsonMessage) (jpf.Message, error) {
+	switch msg.Role {
+	case "user":
+		images := make([]jpf.ImageAttachment, 0, len(msg.Images))
+		for _, enc := range msg.Images {
+			img, err := decodeImage(enc)
+			if err != nil {
+				return nil, Wrap(err, "failed to decode image")
+			}
+			images = append(images, jpf.ImageAttachment{Source: img})
+		}
+		if len(images) == 0 {
+			images = nil
+		}
+		return jpf.UserMessage{Content: msg.Content, Images: images}, nil
+	case "assistant":
+		return jpf.AssistantMessage{Content: msg.Content, ToolCalls: ToolCallsFromJson(msg.ToolCalls)}, nil
+	case "developer":
+		return jpf.DeveloperMessage{Content: msg.Content}, nil
+	case "system":
+		return jpf.SystemMessage{Content: msg.Content}, nil
+	case "tool":
+		return jpf.ToolResultMessage{CallID: msg.CallID, Result: msg.Content}, nil
+	default:
+		return nil, fmt.Errorf("unrecognised message role '%s'", msg.Role)
+	}
+}
+
+func MessagesToJson(msgs []jpf.Message) ([]JsonMessage, error) {
+	res := make([]JsonMessage, len(msgs))
+	for i, msg := range msgs {
+		jm, err := MessageToJson(msg)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = jm
+	}
+	return res, nil
+}
+
+func MessagesFromJson(msgs []JsonMessage) ([]jpf.Message, error) {
+	res := make([]jpf.Message, len(msgs))
+	for i, msg := range msgs {
+		m, err := MessageFromJson(msg)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = m
+	}
+	return res, nil
+}
+
+func ToolCallsToJson(calls []jpf.ToolCall) []JsonToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+	res := make([]JsonToolCall, len(calls))
+	for i, tc := range calls {
+		res[i] = JsonToolCall{ID: tc.ID, Tool: tc.Tool, Args: tc.Args}
+	}
+	return res
+}
+
+func ToolCallsFromJson(calls []JsonToolCall) []jpf.ToolCall {
+	if len(calls) == 0 {
+		return nil
+	}
+	res := make([]jpf.ToolCall, len(calls))
+	for i, tc := range calls {
+		res[i] = jpf.ToolCall{ID: tc.ID, Tool: tc.Tool, Args: tc.Args}
+	}
+	return res
+}
+
+func decodeImage(dataURL string) (image.Image, error) {
+	_, data, ok := strings.Cut(dataURL, ";base64,")
+	if !ok {
+		return nil, fmt.Errorf("image was not a base64 data url")
+	}
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	return img, err
+}
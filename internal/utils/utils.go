@@ -1,10 +1,27 @@
 package utils
 
 import (
-	"errors"
 	"fmt"
 )
 
+// Wrap adds a line describing what failed above the message of err.
 func Wrap(err error, msg string, args ...any) error {
-	return errors.Join(fmt.Errorf(msg, args...), err)
+	if err == nil {
+		return fmt.Errorf(msg, args...)
+	}
+	return &WrappedError{Msg: fmt.Sprintf(msg, args...), Err: err}
+}
+
+// WrappedError is the error returned by [Wrap], so that the line it added can be told apart from the error it wraps.
+type WrappedError struct {
+	Msg string
+	Err error
+}
+
+func (e *WrappedError) Error() string {
+	return e.Msg + "\n" + e.Err.Error()
+}
+
+func (e *WrappedError) Unwrap() error {
+	return e.Err
 }
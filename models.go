@@ -108,6 +108,27 @@ type Message interface {
 	Eq(Message) bool
 }
 
+// Role is the author of a plain text message that is sent to a model, such as feedback from a pipeline.
+type Role uint8
+
+const (
+	UserRole Role = iota
+	DeveloperRole
+	SystemRole
+)
+
+// Message creates a message with the role and content.
+func (r Role) Message(content string) Message {
+	switch r {
+	case DeveloperRole:
+		return DeveloperMessage{Content: content}
+	case SystemRole:
+		return SystemMessage{Content: content}
+	default:
+		return UserMessage{Content: content}
+	}
+}
+
 func (UserMessage) msg()       {}
 func (AssistantMessage) msg()  {}
 func (DeveloperMessage) msg()  {}
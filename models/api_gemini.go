@@ -55,14 +55,22 @@ func (m *apiGeminiModel) Respond(ctx context.Context, msgs []jpf.Message, opts .
 		respTyped, rawRespBytes, err = m.parseStaticResponse(ctx, resp.Body)
 	}
 
-	usage := jpf.Usage{
+	if err != nil {
+		return failedResponseAfter(m.usage(respTyped)), utils.Wrap(err, "failed to parse response: %s", string(rawRespBytes))
+	}
+	return m.response(respTyped, rawRespBytes)
+}
+
+func (m *apiGeminiModel) usage(respTyped geminiStaticResponse) jpf.Usage {
+	return jpf.Usage{
 		InputTokens:  respTyped.UsageMetadata.InputTokens,
 		OutputTokens: respTyped.UsageMetadata.OutputTokens,
 	}
-	if err != nil {
-		return failedResponseAfter(usage), utils.Wrap(err, "failed to parse response: %s", string(rawRespBytes))
-	}
+}
 
+// response converts a parsed generate content response into a model response.
+func (m *apiGeminiModel) response(respTyped geminiStaticResponse, rawRespBytes []byte) (jpf.ModelResponse, error) {
+	usage := m.usage(respTyped)
 	if len(respTyped.Candidates) == 0 || len(respTyped.Candidates[0].Content.Parts) == 0 {
 		return failedResponseAfter(usage), fmt.Errorf("response had no content: %s", string(rawRespBytes))
 	}
@@ -54,13 +54,22 @@ func (m *apiOpenAIModel) Respond(ctx context.Context, msgs []jpf.Message, opts .
 		respTyped, rawRespBytes, err = m.parseStaticResponse(ctx, resp.Body)
 	}
 
-	usage := jpf.Usage{
+	if err != nil {
+		return failedResponseAfter(m.usage(respTyped)), utils.Wrap(err, "failed to parse response: %s", string(rawRespBytes))
+	}
+	return m.response(respTyped, rawRespBytes)
+}
+
+func (m *apiOpenAIModel) usage(respTyped openAIAPIStaticResponse) jpf.Usage {
+	return jpf.Usage{
 		InputTokens:  respTyped.Usage.InputTokens,
 		OutputTokens: respTyped.Usage.OutputTokens,
 	}
-	if err != nil {
-		return failedResponseAfter(usage), utils.Wrap(err, "failed to parse response: %s", string(rawRespBytes))
-	}
+}
+
+// response converts a parsed chat completion into a model response.
+func (m *apiOpenAIModel) response(respTyped openAIAPIStaticResponse, rawRespBytes []byte) (jpf.ModelResponse, error) {
+	usage := m.usage(respTyped)
 	if respTyped.Error.Code != "" {
 		return failedResponseAfter(usage), &openAIError{
 			respTyped.Error.Message,
@@ -69,7 +78,7 @@ func (m *apiOpenAIModel) Respond(ctx context.Context, msgs []jpf.Message, opts .
 		}
 	}
 	if len(respTyped.Choices) == 0 {
-		return failedResponseAfter(usage), utils.Wrap(err, "response had no choices: %s", string(rawRespBytes))
+		return failedResponseAfter(usage), fmt.Errorf("response had no choices: %s", string(rawRespBytes))
 	}
 	content := respTyped.Choices[0].Message.Content
 	toolCalls := make([]jpf.ToolCall, len(respTyped.Choices[0].Message.ToolCalls))
@@ -0,0 +1,318 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/internal/utils"
+)
+
+// BatchRequest is one request to a model, made as part of a batch job.
+type BatchRequest struct {
+	// Identifies the request, so that its result can be found. It must be unique within the batch.
+	ID string
+	// The messages to respond to.
+	Messages []jpf.Message
+	// Options for the response, such as the output format. Streaming is not supported.
+	Opts []jpf.ModelResponseOpt
+}
+
+// BatchResult is the outcome of one request in a batch job.
+type BatchResult struct {
+	Response jpf.ModelResponse
+	Err      error
+}
+
+// BatchState is the progress of a batch job.
+type BatchState uint8
+
+const (
+	BatchPending BatchState = iota
+	BatchRunning
+	BatchSucceeded
+	BatchFailed
+	// The job was not finished in time. Some requests may still have results.
+	BatchExpired
+	BatchCancelled
+)
+
+func (s BatchState) String() string {
+	switch s {
+	case BatchPending:
+		return "pending"
+	case BatchRunning:
+		return "running"
+	case BatchSucceeded:
+		return "succeeded"
+	case BatchFailed:
+		return "failed"
+	case BatchExpired:
+		return "expired"
+	case BatchCancelled:
+		return "cancelled"
+	default:
+		return fmt.Sprintf("unknown(%d)", s)
+	}
+}
+
+// Done returns true if the job will not make any more progress.
+func (s BatchState) Done() bool {
+	return s >= BatchSucceeded
+}
+
+// BatchAPI runs many model requests as a single job on a provider's batch endpoint, which is cheaper than calling the model for each,
+// but may take hours to complete.
+type BatchAPI interface {
+	// Submit writes the requests in the provider's jsonl format, uploads them, and starts a batch job, returning the id of the job.
+	Submit(ctx context.Context, requests []BatchRequest) (string, error)
+	// Status returns the current state of the job.
+	Status(ctx context.Context, jobID string) (BatchState, error)
+	// Results downloads the results of a finished job, by request id.
+	Results(ctx context.Context, jobID string) (map[string]BatchResult, error)
+}
+
+// NewBatchAPI creates a [BatchAPI] for the provider's batch endpoint, using the same options as [NewRemote].
+// The url (see [WithURL]) is the same as would be given to [NewRemote], and the batch endpoints are found relative to it.
+func NewBatchAPI(format APIFormat, name string, key string, opts ...APIModelOpt) BatchAPI {
+	switch model := NewRemote(format, name, key, opts...).(type) {
+	case *apiOpenAIModel:
+		return &apiOpenAIBatch{model}
+	case *apiGeminiModel:
+		return &apiGeminiBatch{model}
+	default:
+		panic("unrecognised format")
+	}
+}
+
+// ErrBatchExpired is returned by [RunBatch] when a job was not finished in time, along with the results of the requests that were run.
+var ErrBatchExpired = errors.New("batch job expired before every request was run")
+
+// RunBatch submits the requests as a batch job, waits for it to finish, and returns the result of every request by id.
+// A request failing does not fail the batch, and its error is in its result.
+// An error is returned if the job could not be run, or failed or was cancelled as a whole.
+// If the job expired, the results are returned along with an error wrapping [ErrBatchExpired].
+// Use [WithJobFile] so that if the process is restarted, calling RunBatch again resumes waiting for the same job instead of paying for a new one.
+func RunBatch(ctx context.Context, api BatchAPI, requests []BatchRequest, opts ...RunBatchOpt) (map[string]BatchResult, error) {
+	settings := runBatchSettings{pollInterval: 30 * time.Second}
+	for _, o := range opts {
+		o(&settings)
+	}
+	requestsHash := hashBatchRequests(requests)
+	jobID, err := settings.submittedJob(requestsHash)
+	if err != nil {
+		return nil, utils.Wrap(err, "failed to read job file")
+	}
+	if jobID == "" {
+		jobID, err = api.Submit(ctx, requests)
+		if err != nil {
+			return nil, utils.Wrap(err, "failed to submit batch job")
+		}
+		if err := settings.saveJob(jobID, requestsHash); err != nil {
+			return nil, utils.Wrap(err, "batch job %s was submitted, but its id could not be saved to the job file", jobID)
+		}
+	}
+	var state BatchState
+	for {
+		state, err = api.Status(ctx, jobID)
+		if err != nil {
+			return nil, utils.Wrap(err, "failed to get status of batch job %s", jobID)
+		}
+		if state.Done() {
+			break
+		}
+		select {
+		case <-time.After(settings.pollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if state == BatchFailed || state == BatchCancelled {
+		if err := settings.clearJob(); err != nil {
+			return nil, utils.Wrap(err, "batch job %s %s, and the job file could not be removed", jobID, state)
+		}
+		return nil, fmt.Errorf("batch job %s %s", jobID, state)
+	}
+	results, err := api.Results(ctx, jobID)
+	if err != nil {
+		return nil, utils.Wrap(err, "failed to get results of batch job %s", jobID)
+	}
+	for _, r := range requests {
+		if _, ok := results[r.ID]; !ok {
+			results[r.ID] = BatchResult{Response: failedResponse(), Err: fmt.Errorf("batch job %s returned no result for request %s", jobID, r.ID)}
+		}
+	}
+	if err := settings.clearJob(); err != nil {
+		return results, utils.Wrap(err, "failed to remove job file")
+	}
+	if state == BatchExpired {
+		return results, fmt.Errorf("batch job %s: %w", jobID, ErrBatchExpired)
+	}
+	return results, nil
+}
+
+type RunBatchOpt func(*runBatchSettings)
+
+type runBatchSettings struct {
+	pollInterval time.Duration
+	jobFile      string
+}
+
+// Check the status of the job at this interval, which defaults to 30 seconds.
+func WithPollInterval(interval time.Duration) RunBatchOpt {
+	return func(s *runBatchSettings) { s.pollInterval = interval }
+}
+
+// Save the id of the submitted job to the file. If the file already has a job id, that job is resumed instead of submitting a new one.
+// The file also records the ids of the requests, and resuming fails if they have changed. Delete the file to submit a new job.
+// The file is removed once the job has finished.
+func WithJobFile(path string) RunBatchOpt {
+	return func(s *runBatchSettings) { s.jobFile = path }
+}
+
+// batchJobFile is the contents of a job file.
+type batchJobFile struct {
+	JobID    string `json:"job_id"`
+	Requests string `json:"requests"`
+}
+
+// submittedJob returns the job id saved in the job file, or an empty string if there is none.
+// An error is returned if the job was submitted for requests with a different hash.
+func (s runBatchSettings) submittedJob(requestsHash string) (string, error) {
+	if s.jobFile == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(s.jobFile)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	var job batchJobFile
+	if err := json.Unmarshal(data, &job); err != nil {
+		return "", utils.Wrap(err, "could not decode job file %s", s.jobFile)
+	}
+	if job.Requests != requestsHash {
+		return "", fmt.Errorf("batch job %s in %s was submitted for different requests, delete the file to submit a new job", job.JobID, s.jobFile)
+	}
+	return job.JobID, nil
+}
+
+func (s runBatchSettings) saveJob(jobID, requestsHash string) error {
+	if s.jobFile == "" {
+		return nil
+	}
+	data, err := json.Marshal(batchJobFile{JobID: jobID, Requests: requestsHash})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.jobFile, data, 0644)
+}
+
+func (s runBatchSettings) clearJob() error {
+	if s.jobFile == "" {
+		return nil
+	}
+	if err := os.Remove(s.jobFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// hashBatchRequests hashes the ids of the requests, to check that a saved job was submitted for the same requests.
+func hashBatchRequests(requests []BatchRequest) string {
+	hash := sha256.New()
+	for _, r := range requests {
+		fmt.Fprintf(hash, "%d:%s", len(r.ID), r.ID)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// checkBatchRequests checks that every request has a unique id and can be made in a batch, returning the options of each request.
+func checkBatchRequests(requests []BatchRequest) ([]jpf.ModelResponseKwargs, error) {
+	if len(requests) == 0 {
+		return nil, errors.New("a batch must have at least one request")
+	}
+	seen := make(map[string]bool)
+	kwargs := make([]jpf.ModelResponseKwargs, len(requests))
+	for i, r := range requests {
+		if r.ID == "" {
+			return nil, fmt.Errorf("request %d has no id", i)
+		}
+		if seen[r.ID] {
+			return nil, fmt.Errorf("request id %s is used more than once", r.ID)
+		}
+		seen[r.ID] = true
+		kwargs[i] = jpf.GetModelResponseKwargs(r.Opts...)
+		if kwargs[i].Streamer != nil {
+			return nil, fmt.Errorf("request %s cannot be streamed in a batch", r.ID)
+		}
+	}
+	return kwargs, nil
+}
+
+// encodeJsonLines encodes each value as a line of json.
+func encodeJsonLines(values []any) ([]byte, error) {
+	var buf strings.Builder
+	enc := json.NewEncoder(&buf)
+	for _, v := range values {
+		if err := enc.Encode(v); err != nil {
+			return nil, err
+		}
+	}
+	return []byte(buf.String()), nil
+}
+
+// decodeJsonLines decodes each non-empty line of the data into a new T.
+func decodeJsonLines[T any](data []byte) ([]T, error) {
+	values := make([]T, 0)
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var v T
+		if err := json.Unmarshal([]byte(line), &v); err != nil {
+			return nil, utils.Wrap(err, "could not decode line %d", i+1)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// doBatchRequest executes the request, returning the response body, or an error if the request did not succeed.
+func doBatchRequest(req *http.Request) ([]byte, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, utils.Wrap(err, "could not execute request")
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, utils.Wrap(err, "could not read response body")
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("request to %s failed with status %d: %s", req.URL.Path, resp.StatusCode, string(data))
+	}
+	return data, nil
+}
+
+// doBatchJsonRequest executes the request, decoding the response body as json into out.
+func doBatchJsonRequest(req *http.Request, out any) error {
+	data, err := doBatchRequest(req)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return utils.Wrap(err, "could not unmarshal response body: %s", string(data))
+	}
+	return nil
+}
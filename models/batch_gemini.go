@@ -0,0 +1,254 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+
+	"github.com/JoshPattman/jpf/internal/utils"
+)
+
+// apiGeminiBatch uses the Gemini files and batch endpoints, building each request in the same way as the model.
+type apiGeminiBatch struct {
+	model *apiGeminiModel
+}
+
+// urls returns the api root that the models url is under, and the roots for uploading and downloading files.
+func (b *apiGeminiBatch) urls() (base, upload, download string, err error) {
+	base = strings.TrimSuffix(b.model.settings.url, "/models")
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", "", "", utils.Wrap(err, "could not parse url")
+	}
+	host := u.Scheme + "://" + u.Host
+	return base, host + "/upload" + u.Path, host + "/download" + u.Path, nil
+}
+
+func (b *apiGeminiBatch) Submit(ctx context.Context, requests []BatchRequest) (string, error) {
+	kwargs, err := checkBatchRequests(requests)
+	if err != nil {
+		return "", err
+	}
+	lines := make([]any, len(requests))
+	for i, r := range requests {
+		if err := b.model.validateNoUnusableArgs(kwargs[i]); err != nil {
+			return "", utils.Wrap(err, "could not validate model setup")
+		}
+		systemMessage, msgs, err := b.model.messages(r.Messages)
+		if err != nil {
+			return "", utils.Wrap(err, "could not convert messages of request %s to Gemini format", r.ID)
+		}
+		body, err := b.model.body(systemMessage, kwargs[i].ToolSchemas, kwargs[i].OutputFormat, msgs)
+		if err != nil {
+			return "", utils.Wrap(err, "could not create body for request %s", r.ID)
+		}
+		lines[i] = geminiBatchRequestLine{Key: r.ID, Request: body}
+	}
+	data, err := encodeJsonLines(lines)
+	if err != nil {
+		return "", utils.Wrap(err, "could not encode requests")
+	}
+	fileName, err := b.upload(ctx, data)
+	if err != nil {
+		return "", utils.Wrap(err, "could not upload requests")
+	}
+	body, err := json.Marshal(map[string]any{
+		"batch": map[string]any{
+			"display_name": "jpf batch",
+			"input_config": map[string]any{"file_name": fileName},
+		},
+	})
+	if err != nil {
+		return "", utils.Wrap(err, "could not encode body")
+	}
+	base, _, _, err := b.urls()
+	if err != nil {
+		return "", err
+	}
+	req, err := b.createRequest(ctx, "POST", fmt.Sprintf("%s/models/%s:batchGenerateContent", base, b.model.name), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	var job geminiBatchJob
+	if err := doBatchJsonRequest(req, &job); err != nil {
+		return "", utils.Wrap(err, "could not create batch")
+	}
+	return job.Name, nil
+}
+
+func (b *apiGeminiBatch) Status(ctx context.Context, jobID string) (BatchState, error) {
+	job, err := b.job(ctx, jobID)
+	if err != nil {
+		return BatchPending, err
+	}
+	switch job.Metadata.State {
+	case "BATCH_STATE_PENDING", "BATCH_STATE_UNSPECIFIED":
+		return BatchPending, nil
+	case "BATCH_STATE_RUNNING":
+		return BatchRunning, nil
+	case "BATCH_STATE_SUCCEEDED":
+		return BatchSucceeded, nil
+	case "BATCH_STATE_FAILED":
+		return BatchFailed, nil
+	case "BATCH_STATE_EXPIRED":
+		return BatchExpired, nil
+	case "BATCH_STATE_CANCELLED":
+		return BatchCancelled, nil
+	default:
+		return BatchPending, fmt.Errorf("unrecognised batch state '%s'", job.Metadata.State)
+	}
+}
+
+func (b *apiGeminiBatch) Results(ctx context.Context, jobID string) (map[string]BatchResult, error) {
+	job, err := b.job(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	results := make(map[string]BatchResult)
+	fileName := job.Response.ResponsesFile
+	if fileName == "" {
+		return results, nil
+	}
+	_, _, download, err := b.urls()
+	if err != nil {
+		return nil, err
+	}
+	req, err := b.createRequest(ctx, "GET", fmt.Sprintf("%s/%s:download?alt=media", download, fileName), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	data, err := doBatchRequest(req)
+	if err != nil {
+		return nil, utils.Wrap(err, "could not download results file %s", fileName)
+	}
+	lines, err := decodeJsonLines[geminiBatchResultLine](data)
+	if err != nil {
+		return nil, utils.Wrap(err, "could not decode results file %s", fileName)
+	}
+	for _, line := range lines {
+		results[line.Key] = b.result(line)
+	}
+	return results, nil
+}
+
+func (b *apiGeminiBatch) result(line geminiBatchResultLine) BatchResult {
+	if line.Error != nil {
+		return BatchResult{failedResponse(), &geminiError{line.Error.Message, line.Error.Status, line.Error.Code}}
+	}
+	var respTyped geminiStaticResponse
+	if err := json.Unmarshal(line.Response, &respTyped); err != nil {
+		return BatchResult{failedResponse(), utils.Wrap(err, "could not unmarshal response body: %s", string(line.Response))}
+	}
+	resp, err := b.model.response(respTyped, line.Response)
+	return BatchResult{resp, err}
+}
+
+func (b *apiGeminiBatch) job(ctx context.Context, jobID string) (geminiBatchJob, error) {
+	base, _, _, err := b.urls()
+	if err != nil {
+		return geminiBatchJob{}, err
+	}
+	req, err := b.createRequest(ctx, "GET", base+"/"+jobID, "", nil)
+	if err != nil {
+		return geminiBatchJob{}, err
+	}
+	var job geminiBatchJob
+	if err := doBatchJsonRequest(req, &job); err != nil {
+		return geminiBatchJob{}, utils.Wrap(err, "could not get batch")
+	}
+	return job, nil
+}
+
+// upload uploads the jsonl data as a file, returning the name of the file.
+func (b *apiGeminiBatch) upload(ctx context.Context, data []byte) (string, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	metadata, err := parts.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/json; charset=UTF-8"}})
+	if err != nil {
+		return "", err
+	}
+	if err := json.NewEncoder(metadata).Encode(map[string]any{"file": map[string]any{"display_name": "jpf batch"}}); err != nil {
+		return "", err
+	}
+	file, err := parts.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/jsonl"}})
+	if err != nil {
+		return "", err
+	}
+	if _, err := file.Write(data); err != nil {
+		return "", err
+	}
+	if err := parts.Close(); err != nil {
+		return "", err
+	}
+	_, upload, _, err := b.urls()
+	if err != nil {
+		return "", err
+	}
+	req, err := b.createRequest(ctx, "POST", upload+"/files?uploadType=multipart", "multipart/related; boundary="+parts.Boundary(), &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Add("X-Goog-Upload-Protocol", "multipart")
+	var uploaded struct {
+		File struct {
+			Name string `json:"name"`
+		} `json:"file"`
+	}
+	if err := doBatchJsonRequest(req, &uploaded); err != nil {
+		return "", err
+	}
+	return uploaded.File.Name, nil
+}
+
+func (b *apiGeminiBatch) createRequest(ctx context.Context, method, rawURL, contentType string, body io.Reader) (*http.Request, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, utils.Wrap(err, "could not parse url")
+	}
+	query := u.Query()
+	query.Set("key", b.model.key)
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, utils.Wrap(err, "could not create request")
+	}
+	if contentType != "" {
+		req.Header.Add("Content-Type", contentType)
+	}
+	for k, v := range b.model.settings.headers {
+		req.Header.Add(k, v)
+	}
+	return req, nil
+}
+
+type geminiBatchRequestLine struct {
+	Key     string         `json:"key"`
+	Request map[string]any `json:"request"`
+}
+
+type geminiBatchResultLine struct {
+	Key      string          `json:"key"`
+	Response json.RawMessage `json:"response"`
+	Error    *struct {
+		Message string `json:"message"`
+		Status  string `json:"status"`
+		Code    int    `json:"code"`
+	} `json:"error"`
+}
+
+type geminiBatchJob struct {
+	Name     string `json:"name"`
+	Metadata struct {
+		State string `json:"state"`
+	} `json:"metadata"`
+	Response struct {
+		ResponsesFile string `json:"responsesFile"`
+	} `json:"response"`
+}
@@ -0,0 +1,223 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/JoshPattman/jpf/internal/utils"
+)
+
+// apiOpenAIBatch uses the OpenAI files and batches endpoints, building each request in the same way as the model.
+type apiOpenAIBatch struct {
+	model *apiOpenAIModel
+}
+
+// baseURL is the api root that the chat completions url is under.
+func (b *apiOpenAIBatch) baseURL() string {
+	return strings.TrimSuffix(b.model.settings.url, "/chat/completions")
+}
+
+func (b *apiOpenAIBatch) Submit(ctx context.Context, requests []BatchRequest) (string, error) {
+	kwargs, err := checkBatchRequests(requests)
+	if err != nil {
+		return "", err
+	}
+	lines := make([]any, len(requests))
+	for i, r := range requests {
+		msgs, err := b.model.messages(r.Messages)
+		if err != nil {
+			return "", utils.Wrap(err, "could not convert messages of request %s to OpenAI format", r.ID)
+		}
+		body, err := b.model.body(msgs, false, kwargs[i].OutputFormat, kwargs[i].ToolSchemas)
+		if err != nil {
+			return "", utils.Wrap(err, "could not create OpenAI format body for request %s", r.ID)
+		}
+		lines[i] = openAIBatchRequestLine{CustomID: r.ID, Method: "POST", URL: "/v1/chat/completions", Body: body}
+	}
+	data, err := encodeJsonLines(lines)
+	if err != nil {
+		return "", utils.Wrap(err, "could not encode requests")
+	}
+	fileID, err := b.upload(ctx, data)
+	if err != nil {
+		return "", utils.Wrap(err, "could not upload requests")
+	}
+	body, err := json.Marshal(map[string]any{
+		"input_file_id":     fileID,
+		"endpoint":          "/v1/chat/completions",
+		"completion_window": "24h",
+	})
+	if err != nil {
+		return "", utils.Wrap(err, "could not encode body")
+	}
+	req, err := b.createRequest(ctx, "POST", "/batches", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	var job openAIBatchJob
+	if err := doBatchJsonRequest(req, &job); err != nil {
+		return "", utils.Wrap(err, "could not create batch")
+	}
+	return job.ID, nil
+}
+
+func (b *apiOpenAIBatch) Status(ctx context.Context, jobID string) (BatchState, error) {
+	job, err := b.job(ctx, jobID)
+	if err != nil {
+		return BatchPending, err
+	}
+	switch job.Status {
+	case "validating":
+		return BatchPending, nil
+	case "in_progress", "finalizing":
+		return BatchRunning, nil
+	case "completed":
+		return BatchSucceeded, nil
+	case "failed":
+		return BatchFailed, nil
+	case "expired":
+		return BatchExpired, nil
+	case "cancelling", "cancelled":
+		return BatchCancelled, nil
+	default:
+		return BatchPending, fmt.Errorf("unrecognised batch status '%s'", job.Status)
+	}
+}
+
+func (b *apiOpenAIBatch) Results(ctx context.Context, jobID string) (map[string]BatchResult, error) {
+	job, err := b.job(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	results := make(map[string]BatchResult)
+	// Successful requests are in the output file, and failed requests are in the error file.
+	for _, fileID := range []string{job.OutputFileID, job.ErrorFileID} {
+		if fileID == "" {
+			continue
+		}
+		req, err := b.createRequest(ctx, "GET", "/files/"+fileID+"/content", "", nil)
+		if err != nil {
+			return nil, err
+		}
+		data, err := doBatchRequest(req)
+		if err != nil {
+			return nil, utils.Wrap(err, "could not download results file %s", fileID)
+		}
+		lines, err := decodeJsonLines[openAIBatchResultLine](data)
+		if err != nil {
+			return nil, utils.Wrap(err, "could not decode results file %s", fileID)
+		}
+		for _, line := range lines {
+			results[line.CustomID] = b.result(line)
+		}
+	}
+	return results, nil
+}
+
+func (b *apiOpenAIBatch) result(line openAIBatchResultLine) BatchResult {
+	if line.Error != nil {
+		return BatchResult{failedResponse(), &openAIError{line.Error.Message, "batch", line.Error.Code}}
+	}
+	if line.Response.StatusCode < 200 || line.Response.StatusCode >= 300 {
+		var errResp openAIErrorResponse
+		if err := json.Unmarshal(line.Response.Body, &errResp); err != nil {
+			return BatchResult{failedResponse(), fmt.Errorf("request failed with status %d: %s", line.Response.StatusCode, string(line.Response.Body))}
+		}
+		return BatchResult{failedResponse(), &openAIError{errResp.Error.Message, errResp.Error.Type, errResp.Error.Code}}
+	}
+	var respTyped openAIAPIStaticResponse
+	if err := json.Unmarshal(line.Response.Body, &respTyped); err != nil {
+		return BatchResult{failedResponse(), utils.Wrap(err, "could not unmarshal response body: %s", string(line.Response.Body))}
+	}
+	resp, err := b.model.response(respTyped, line.Response.Body)
+	return BatchResult{resp, err}
+}
+
+func (b *apiOpenAIBatch) job(ctx context.Context, jobID string) (openAIBatchJob, error) {
+	req, err := b.createRequest(ctx, "GET", "/batches/"+jobID, "", nil)
+	if err != nil {
+		return openAIBatchJob{}, err
+	}
+	var job openAIBatchJob
+	if err := doBatchJsonRequest(req, &job); err != nil {
+		return openAIBatchJob{}, utils.Wrap(err, "could not get batch")
+	}
+	return job, nil
+}
+
+// upload uploads the jsonl data as a batch input file, returning the id of the file.
+func (b *apiOpenAIBatch) upload(ctx context.Context, data []byte) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.WriteField("purpose", "batch"); err != nil {
+		return "", err
+	}
+	part, err := form.CreateFormFile("file", "batch.jsonl")
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(data); err != nil {
+		return "", err
+	}
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+	req, err := b.createRequest(ctx, "POST", "/files", form.FormDataContentType(), &body)
+	if err != nil {
+		return "", err
+	}
+	var file struct {
+		ID string `json:"id"`
+	}
+	if err := doBatchJsonRequest(req, &file); err != nil {
+		return "", err
+	}
+	return file.ID, nil
+}
+
+func (b *apiOpenAIBatch) createRequest(ctx context.Context, method, path, contentType string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, b.baseURL()+path, body)
+	if err != nil {
+		return nil, utils.Wrap(err, "could not create request")
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", b.model.key))
+	if contentType != "" {
+		req.Header.Add("Content-Type", contentType)
+	}
+	for k, v := range b.model.settings.headers {
+		req.Header.Add(k, v)
+	}
+	return req, nil
+}
+
+type openAIBatchRequestLine struct {
+	CustomID string         `json:"custom_id"`
+	Method   string         `json:"method"`
+	URL      string         `json:"url"`
+	Body     map[string]any `json:"body"`
+}
+
+type openAIBatchResultLine struct {
+	CustomID string `json:"custom_id"`
+	Response struct {
+		StatusCode int             `json:"status_code"`
+		Body       json.RawMessage `json:"body"`
+	} `json:"response"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type openAIBatchJob struct {
+	ID           string `json:"id"`
+	Status       string `json:"status"`
+	OutputFileID string `json:"output_file_id"`
+	ErrorFileID  string `json:"error_file_id"`
+}
@@ -0,0 +1,413 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JoshPattman/jpf"
+)
+
+// fakeBatchServer is a local stand in for the OpenAI and Gemini batch endpoints.
+// Each request is answered with "echo: " followed by the text of its last message,
+// except that "fail" produces an error and "skip" produces no result at all.
+// Jobs report that they are running for the first poll, and then that they have finished.
+type fakeBatchServer struct {
+	*httptest.Server
+	lock        sync.Mutex
+	files       map[string][]byte
+	jobs        map[string]*fakeBatchJob
+	submissions int
+}
+
+type fakeBatchJob struct {
+	input  string
+	polls  int
+	output string
+	errors string
+}
+
+func newFakeBatchServer(t *testing.T) *fakeBatchServer {
+	s := &fakeBatchServer{files: make(map[string][]byte), jobs: make(map[string]*fakeBatchJob)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/files", s.openAIUpload)
+	mux.HandleFunc("POST /v1/batches", s.openAICreate)
+	mux.HandleFunc("GET /v1/batches/{id}", s.openAIGet)
+	mux.HandleFunc("GET /v1/files/{id}/content", s.openAIDownload)
+	mux.HandleFunc("POST /upload/v1beta/files", s.geminiUpload)
+	mux.HandleFunc("POST /v1beta/models/{action}", s.geminiCreate)
+	mux.HandleFunc("GET /v1beta/batches/{id}", s.geminiGet)
+	mux.HandleFunc("GET /download/v1beta/files/{action}", s.geminiDownload)
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *fakeBatchServer) addFile(data []byte) string {
+	name := fmt.Sprintf("file-%d", len(s.files))
+	s.files[name] = data
+	return name
+}
+
+func (s *fakeBatchServer) addJob(input string) string {
+	s.submissions++
+	id := fmt.Sprintf("batch-%d", len(s.jobs))
+	s.jobs[id] = &fakeBatchJob{input: input, polls: 1}
+	return id
+}
+
+// poll returns the job, and whether it has finished, running it when it first finishes.
+func (s *fakeBatchServer) poll(id string, run func(input []byte) (output, errors []byte)) (*fakeBatchJob, bool) {
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	if job.polls > 0 {
+		job.polls--
+		return job, false
+	}
+	if job.output == "" {
+		output, errs := run(s.files[job.input])
+		job.output = s.addFile(output)
+		if len(errs) > 0 {
+			job.errors = s.addFile(errs)
+		}
+	}
+	return job, true
+}
+
+func (s *fakeBatchServer) authorised(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Authorization") == "Bearer key" || r.URL.Query().Get("key") == "key" {
+		return true
+	}
+	http.Error(w, `{"error": {"message": "bad key"}}`, http.StatusUnauthorized)
+	return false
+}
+
+func (s *fakeBatchServer) openAIUpload(w http.ResponseWriter, r *http.Request) {
+	if !s.authorised(w, r) {
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil || r.FormValue("purpose") != "batch" {
+		http.Error(w, "expected a batch file", http.StatusBadRequest)
+		return
+	}
+	data, _ := io.ReadAll(file)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	json.NewEncoder(w).Encode(map[string]any{"id": s.addFile(data)})
+}
+
+func (s *fakeBatchServer) openAICreate(w http.ResponseWriter, r *http.Request) {
+	if !s.authorised(w, r) {
+		return
+	}
+	var body struct {
+		InputFileID string `json:"input_file_id"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	json.NewEncoder(w).Encode(map[string]any{"id": s.addJob(body.InputFileID), "status": "validating"})
+}
+
+func (s *fakeBatchServer) openAIGet(w http.ResponseWriter, r *http.Request) {
+	if !s.authorised(w, r) {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	job, done := s.poll(r.PathValue("id"), runOpenAIBatch)
+	switch {
+	case job == nil:
+		http.NotFound(w, r)
+	case !done:
+		json.NewEncoder(w).Encode(map[string]any{"id": r.PathValue("id"), "status": "in_progress"})
+	default:
+		json.NewEncoder(w).Encode(map[string]any{"id": r.PathValue("id"), "status": "completed", "output_file_id": job.output, "error_file_id": job.errors})
+	}
+}
+
+func (s *fakeBatchServer) openAIDownload(w http.ResponseWriter, r *http.Request) {
+	if !s.authorised(w, r) {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	w.Write(s.files[r.PathValue("id")])
+}
+
+func runOpenAIBatch(input []byte) ([]byte, []byte) {
+	var output, errs strings.Builder
+	for _, line := range strings.Split(strings.TrimSpace(string(input)), "\n") {
+		var req struct {
+			CustomID string `json:"custom_id"`
+			Body     struct {
+				Messages []struct {
+					Content string `json:"content"`
+				} `json:"messages"`
+			} `json:"body"`
+		}
+		json.Unmarshal([]byte(line), &req)
+		text := req.Body.Messages[len(req.Body.Messages)-1].Content
+		switch text {
+		case "skip":
+		case "fail":
+			json.NewEncoder(&errs).Encode(map[string]any{
+				"custom_id": req.CustomID,
+				"response": map[string]any{
+					"status_code": 400,
+					"body":        map[string]any{"error": map[string]any{"message": "cannot fail", "type": "invalid_request_error", "code": "bad"}},
+				},
+			})
+		default:
+			json.NewEncoder(&output).Encode(map[string]any{
+				"custom_id": req.CustomID,
+				"response": map[string]any{
+					"status_code": 200,
+					"body": map[string]any{
+						"choices": []any{map[string]any{"message": map[string]any{"content": "echo: " + text}}},
+						"usage":   map[string]any{"prompt_tokens": 3, "completion_tokens": 2},
+					},
+				},
+			})
+		}
+	}
+	return []byte(output.String()), []byte(errs.String())
+}
+
+func (s *fakeBatchServer) geminiUpload(w http.ResponseWriter, r *http.Request) {
+	if !s.authorised(w, r) {
+		return
+	}
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || r.URL.Query().Get("uploadType") != "multipart" {
+		http.Error(w, "expected a multipart upload", http.StatusBadRequest)
+		return
+	}
+	parts := multipart.NewReader(r.Body, params["boundary"])
+	parts.NextPart() // metadata
+	file, err := parts.NextPart()
+	if err != nil {
+		http.Error(w, "expected a file", http.StatusBadRequest)
+		return
+	}
+	data, _ := io.ReadAll(file)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	json.NewEncoder(w).Encode(map[string]any{"file": map[string]any{"name": "files/" + s.addFile(data)}})
+}
+
+func (s *fakeBatchServer) geminiCreate(w http.ResponseWriter, r *http.Request) {
+	if !s.authorised(w, r) {
+		return
+	}
+	if !strings.HasSuffix(r.PathValue("action"), ":batchGenerateContent") {
+		http.NotFound(w, r)
+		return
+	}
+	var body struct {
+		Batch struct {
+			InputConfig struct {
+				FileName string `json:"file_name"`
+			} `json:"input_config"`
+		} `json:"batch"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	id := s.addJob(strings.TrimPrefix(body.Batch.InputConfig.FileName, "files/"))
+	json.NewEncoder(w).Encode(map[string]any{"name": "batches/" + id, "metadata": map[string]any{"state": "BATCH_STATE_PENDING"}})
+}
+
+func (s *fakeBatchServer) geminiGet(w http.ResponseWriter, r *http.Request) {
+	if !s.authorised(w, r) {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	job, done := s.poll(r.PathValue("id"), runGeminiBatch)
+	switch {
+	case job == nil:
+		http.NotFound(w, r)
+	case !done:
+		json.NewEncoder(w).Encode(map[string]any{"metadata": map[string]any{"state": "BATCH_STATE_RUNNING"}})
+	default:
+		json.NewEncoder(w).Encode(map[string]any{
+			"metadata": map[string]any{"state": "BATCH_STATE_SUCCEEDED"},
+			"response": map[string]any{"responsesFile": "files/" + job.output},
+		})
+	}
+}
+
+func (s *fakeBatchServer) geminiDownload(w http.ResponseWriter, r *http.Request) {
+	if !s.authorised(w, r) {
+		return
+	}
+	name, ok := strings.CutSuffix(r.PathValue("action"), ":download")
+	if !ok || r.URL.Query().Get("alt") != "media" {
+		http.NotFound(w, r)
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	w.Write(s.files[name])
+}
+
+func runGeminiBatch(input []byte) ([]byte, []byte) {
+	var output strings.Builder
+	for _, line := range strings.Split(strings.TrimSpace(string(input)), "\n") {
+		var req struct {
+			Key     string `json:"key"`
+			Request struct {
+				Contents []struct {
+					Parts []struct {
+						Text string `json:"text"`
+					} `json:"parts"`
+				} `json:"contents"`
+			} `json:"request"`
+		}
+		json.Unmarshal([]byte(line), &req)
+		text := req.Request.Contents[len(req.Request.Contents)-1].Parts[0].Text
+		switch text {
+		case "skip":
+		case "fail":
+			json.NewEncoder(&output).Encode(map[string]any{
+				"key":   req.Key,
+				"error": map[string]any{"code": 400, "message": "cannot fail", "status": "INVALID_ARGUMENT"},
+			})
+		default:
+			json.NewEncoder(&output).Encode(map[string]any{
+				"key": req.Key,
+				"response": map[string]any{
+					"candidates":    []any{map[string]any{"content": map[string]any{"parts": []any{map[string]any{"text": "echo: " + text}}}}},
+					"usageMetadata": map[string]any{"promptTokenCount": 3, "candidatesTokenCount": 2},
+				},
+			})
+		}
+	}
+	return []byte(output.String()), nil
+}
+
+func TestRunBatch(t *testing.T) {
+	server := newFakeBatchServer(t)
+	apis := map[string]BatchAPI{
+		"openai": NewBatchAPI(OpenAI, "gpt", "key", WithURL(server.URL+"/v1/chat/completions")),
+		"gemini": NewBatchAPI(Google, "gemini", "key", WithURL(server.URL+"/v1beta/models")),
+	}
+	requests := []BatchRequest{
+		{ID: "a", Messages: []jpf.Message{jpf.SystemMessage{Content: "echo"}, jpf.UserMessage{Content: "hello"}}},
+		{ID: "b", Messages: []jpf.Message{jpf.UserMessage{Content: "fail"}}},
+		{ID: "c", Messages: []jpf.Message{jpf.UserMessage{Content: "skip"}}},
+		{ID: "d", Messages: []jpf.Message{jpf.UserMessage{Content: "world"}}},
+	}
+	for name, api := range apis {
+		t.Run(name, func(t *testing.T) {
+			jobFile := filepath.Join(t.TempDir(), "job")
+			submissions := server.submissions
+			// Stop waiting part way through the job, as if the process had been restarted.
+			interrupted, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+			defer cancel()
+			if _, err := RunBatch(interrupted, api, requests, WithPollInterval(time.Hour), WithJobFile(jobFile)); !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("expected waiting for the job to be interrupted, got %v", err)
+			}
+			if _, err := RunBatch(t.Context(), api, requests[:2], WithJobFile(jobFile)); err == nil || !strings.Contains(err.Error(), "different requests") {
+				t.Fatalf("expected resuming with different requests to fail, got %v", err)
+			}
+			// The job should be resumed from the job file instead of submitting a new one.
+			results, err := RunBatch(t.Context(), api, requests, WithPollInterval(time.Millisecond), WithJobFile(jobFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if server.submissions != submissions+1 {
+				t.Fatalf("expected one job to be submitted, got %d", server.submissions-submissions)
+			}
+			if _, err := os.Stat(jobFile); !os.IsNotExist(err) {
+				t.Fatalf("expected the job file to be removed once the job finished, got %v", err)
+			}
+			for _, id := range []string{"a", "d"} {
+				if results[id].Err != nil {
+					t.Fatalf("expected request %s to succeed, got %v", id, results[id].Err)
+				}
+			}
+			expectedUsage := jpf.Usage{InputTokens: 3, OutputTokens: 2, SuccessfulCalls: 1}
+			if results["a"].Response.Message.Content != "echo: hello" || results["d"].Response.Message.Content != "echo: world" || results["a"].Response.Usage != expectedUsage {
+				t.Fatalf("unexpected responses %+v and %+v", results["a"].Response, results["d"].Response)
+			}
+			if results["b"].Err == nil || !strings.Contains(results["b"].Err.Error(), "cannot fail") || results["b"].Response.Usage.FailedCalls != 1 {
+				t.Fatalf("expected request b to fail, got %+v", results["b"])
+			}
+			if results["c"].Err == nil || !strings.Contains(results["c"].Err.Error(), "no result") {
+				t.Fatalf("expected request c to have no result, got %+v", results["c"])
+			}
+		})
+	}
+}
+
+type nopStreamer struct{}
+
+func (nopStreamer) OnMessageBegin()      {}
+func (nopStreamer) OnMessageText(string) {}
+func (nopStreamer) OnMessageReset()      {}
+
+func TestBatchRequestsChecked(t *testing.T) {
+	api := NewBatchAPI(OpenAI, "gpt", "key", WithURL("http://localhost:0/v1/chat/completions"))
+	cases := map[string][]BatchRequest{
+		"empty":        {},
+		"missing id":   {{Messages: []jpf.Message{jpf.UserMessage{Content: "hi"}}}},
+		"duplicate id": {{ID: "a"}, {ID: "a"}},
+		"streamed":     {{ID: "a", Opts: []jpf.ModelResponseOpt{jpf.WithStreamResponse(nopStreamer{})}}},
+	}
+	for name, requests := range cases {
+		if _, err := api.Submit(t.Context(), requests); err == nil {
+			t.Fatalf("expected %s requests to be rejected", name)
+		}
+	}
+}
+
+// expiredBatchAPI is a batch api whose jobs expire after running some of the requests.
+type expiredBatchAPI struct {
+	results map[string]BatchResult
+}
+
+func (a *expiredBatchAPI) Submit(context.Context, []BatchRequest) (string, error) {
+	return "job", nil
+}
+
+func (a *expiredBatchAPI) Status(context.Context, string) (BatchState, error) {
+	return BatchExpired, nil
+}
+
+func (a *expiredBatchAPI) Results(context.Context, string) (map[string]BatchResult, error) {
+	return a.results, nil
+}
+
+func TestRunBatchExpired(t *testing.T) {
+	api := &expiredBatchAPI{results: map[string]BatchResult{
+		"a": {Response: jpf.ModelResponse{Message: jpf.AssistantMessage{Content: "done"}}},
+	}}
+	requests := []BatchRequest{
+		{ID: "a", Messages: []jpf.Message{jpf.UserMessage{Content: "a"}}},
+		{ID: "b", Messages: []jpf.Message{jpf.UserMessage{Content: "b"}}},
+	}
+	results, err := RunBatch(t.Context(), api, requests)
+	if !errors.Is(err, ErrBatchExpired) {
+		t.Fatalf("expected the expiry to be returned, got %v", err)
+	}
+	if results["a"].Err != nil || results["a"].Response.Message.Content != "done" || results["b"].Err == nil {
+		t.Fatalf("expected the partial results to be returned, got %+v", results)
+	}
+}
@@ -2,18 +2,25 @@ package models
 
 import (
 	"context"
+	"errors"
+	"sync"
 
 	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/caches"
 	"github.com/JoshPattman/jpf/internal/utils"
 )
 
 // Cache wraps a Model with response caching functionality.
 // It stores responses in the provided ModelResponseCache implementation,
 // returning cached results for identical input messages and salts to avoid redundant model calls.
+// Concurrent identical requests (same salt and messages) that miss the cache are coalesced,
+// so only one of them calls the underlying model and the rest share its response.
+// Only the caller that made the underlying call has the usage attributed to it.
 func Cache(model jpf.Model, cache jpf.ModelResponseCache, opts ...CachedModelOpt) jpf.Model {
 	m := &cachedModel{
-		model: model,
-		cache: cache,
+		model:    model,
+		cache:    cache,
+		inflight: make(map[string]*inflightCall),
 	}
 	for _, o := range opts {
 		o(m)
@@ -28,9 +35,11 @@ func WithSalt(salt string) func(m *cachedModel) {
 }
 
 type cachedModel struct {
-	model jpf.Model
-	cache jpf.ModelResponseCache
-	salt  string
+	model    jpf.Model
+	cache    jpf.ModelResponseCache
+	salt     string
+	lock     sync.Mutex
+	inflight map[string]*inflightCall
 }
 
 // Respond implements Model.
@@ -49,13 +58,175 @@ func (c *cachedModel) Respond(ctx context.Context, msgs []jpf.Message, opts ...j
 			Message: final,
 		}, nil
 	}
-	resp, err := c.model.Respond(ctx, msgs, opts...)
+	key := caches.HashMessages(c.salt, msgs)
+	for {
+		call, sub, isLeader := c.joinInflight(key, kwargs.Streamer)
+		if isLeader {
+			return c.lead(ctx, key, call, msgs, kwargs.Streamer != nil, opts)
+		}
+		resp, retry, err := c.follow(ctx, call, sub, kwargs.Streamer)
+		if !retry {
+			return resp, err
+		}
+	}
+}
+
+// joinInflight either subscribes to an existing in-flight call for the key, or registers a new one that the caller must lead.
+// The returned subscription id can be used to unsubscribe the streamer later.
+func (c *cachedModel) joinInflight(key string, streamer jpf.ModelStreamer) (*inflightCall, int, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if call, ok := c.inflight[key]; ok {
+		return call, call.subscribe(streamer), false
+	}
+	call := newInflightCall()
+	c.inflight[key] = call
+	return call, call.subscribe(streamer), true
+}
+
+// lead makes the underlying model call on behalf of every caller subscribed to the in-flight call.
+// The underlying call is only streamed if the leader itself asked for streaming.
+func (c *cachedModel) lead(ctx context.Context, key string, call *inflightCall, msgs []jpf.Message, stream bool, opts []jpf.ModelResponseOpt) (jpf.ModelResponse, error) {
+	if stream {
+		opts = append(opts[:len(opts):len(opts)], jpf.WithStreamResponse(call))
+	}
+	resp, err := c.respondUncached(ctx, msgs, opts)
+	c.lock.Lock()
+	delete(c.inflight, key)
+	c.lock.Unlock()
+	call.finish(resp.Message, err)
 	if err != nil {
 		return resp.OnlyUsage(), err
 	}
-	err = c.cache.SetCachedResponse(ctx, c.salt, msgs, resp.Message)
+	return resp, nil
+}
+
+// respondUncached checks the cache again, as another call may have filled it since the first lookup, before calling the underlying model and caching its response.
+func (c *cachedModel) respondUncached(ctx context.Context, msgs []jpf.Message, opts []jpf.ModelResponseOpt) (jpf.ModelResponse, error) {
+	ok, final, err := c.cache.GetCachedResponse(ctx, c.salt, msgs)
+	if err != nil {
+		return jpf.ModelResponse{}, utils.Wrap(err, "failed to query cache")
+	}
+	if ok {
+		return jpf.ModelResponse{Message: final}, nil
+	}
+	resp, err := c.model.Respond(ctx, msgs, opts...)
 	if err != nil {
-		return resp.OnlyUsage(), utils.Wrap(err, "failed to set cache")
+		return resp, err
+	}
+	if err := c.cache.SetCachedResponse(ctx, c.salt, msgs, resp.Message); err != nil {
+		return resp, utils.Wrap(err, "failed to set cache")
 	}
 	return resp, nil
 }
+
+// follow waits for the leader of the in-flight call to finish, returning its message without any usage.
+// If the leader was cancelled but this caller was not, retry will be true and the caller should try again.
+func (c *cachedModel) follow(ctx context.Context, call *inflightCall, sub int, streamer jpf.ModelStreamer) (jpf.ModelResponse, bool, error) {
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		call.unsubscribe(sub)
+		return jpf.ModelResponse{}, false, ctx.Err()
+	}
+	if call.err != nil {
+		if ctx.Err() == nil && (errors.Is(call.err, context.Canceled) || errors.Is(call.err, context.DeadlineExceeded)) {
+			if streamer != nil {
+				streamer.OnMessageReset()
+			}
+			return jpf.ModelResponse{}, true, nil
+		}
+		return jpf.ModelResponse{}, false, utils.Wrap(call.err, "coalesced model call failed")
+	}
+	return jpf.ModelResponse{Message: call.message}, false, nil
+}
+
+// inflightCall is a model call that may be shared by multiple callers.
+// It acts as the streamer of the underlying call, fanning each event out to the streamers of all subscribed callers,
+// and replaying the text so far to any caller that subscribes part-way through.
+// If the underlying call was not streamed, subscribed streamers receive the full message once it finishes.
+type inflightCall struct {
+	lock      sync.Mutex
+	streamers []jpf.ModelStreamer
+	begun     bool
+	text      []string
+	done      chan struct{}
+	message   jpf.AssistantMessage
+	err       error
+}
+
+func newInflightCall() *inflightCall {
+	return &inflightCall{
+		done: make(chan struct{}),
+	}
+}
+
+// subscribe adds the streamer to the fan-out (nil streamers are allowed, and never called) and returns its subscription id.
+func (f *inflightCall) subscribe(streamer jpf.ModelStreamer) int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if streamer != nil && f.begun {
+		streamer.OnMessageBegin()
+		for _, t := range f.text {
+			streamer.OnMessageText(t)
+		}
+	}
+	f.streamers = append(f.streamers, streamer)
+	return len(f.streamers) - 1
+}
+
+func (f *inflightCall) unsubscribe(sub int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if sub < len(f.streamers) {
+		f.streamers[sub] = nil
+	}
+}
+
+func (f *inflightCall) eachStreamer(fn func(jpf.ModelStreamer)) {
+	for _, s := range f.streamers {
+		if s != nil {
+			fn(s)
+		}
+	}
+}
+
+func (f *inflightCall) finish(message jpf.AssistantMessage, err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.message = message
+	f.err = err
+	if err == nil && !f.begun {
+		f.eachStreamer(func(s jpf.ModelStreamer) {
+			s.OnMessageBegin()
+			s.OnMessageText(message.Content)
+		})
+	}
+	f.streamers = nil
+	close(f.done)
+}
+
+// OnMessageBegin implements jpf.ModelStreamer.
+func (f *inflightCall) OnMessageBegin() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.begun = true
+	f.eachStreamer(func(s jpf.ModelStreamer) { s.OnMessageBegin() })
+}
+
+// OnMessageText implements jpf.ModelStreamer.
+func (f *inflightCall) OnMessageText(text string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.text = append(f.text, text)
+	f.eachStreamer(func(s jpf.ModelStreamer) { s.OnMessageText(text) })
+}
+
+// OnMessageReset implements jpf.ModelStreamer.
+func (f *inflightCall) OnMessageReset() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.begun = false
+	f.text = nil
+	f.eachStreamer(func(s jpf.ModelStreamer) { s.OnMessageReset() })
+}
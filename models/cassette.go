@@ -0,0 +1,316 @@
+package models
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/internal/utils"
+	"github.com/invopop/jsonschema"
+)
+
+var ErrCassetteMiss = errors.New("no recorded interaction matched the request")
+
+type CassetteMode uint8
+
+const (
+	// Always call the underlying model, overwriting the cassette with the new interactions.
+	CassetteRecord CassetteMode = iota
+	// Never call the underlying model (it may be nil). Unmatched requests return [ErrCassetteMiss].
+	CassetteReplay
+	// Replay matching interactions, only calling the underlying model (and recording the result) for unmatched requests.
+	CassetteRecordNew
+)
+
+// Cassette wraps a Model so that interactions with it are recorded to, or replayed from, a JSONL fixture file.
+// This allows real model interactions to be recorded once, then replayed deterministically in unit tests without network access.
+// Requests are matched on their messages, output format and tool schemas. If the same request was recorded multiple times,
+// the recordings are replayed in order, repeating the last one once they run out.
+// Each line of the file is a human-readable record including the messages, options, streamed chunks, response and usage.
+func Cassette(model jpf.Model, filename string, mode CassetteMode) (jpf.Model, error) {
+	if model == nil && mode != CassetteReplay {
+		panic("Cassette requires a model unless replaying")
+	}
+	c := &cassetteModel{
+		model:    model,
+		filename: filename,
+		mode:     mode,
+		records:  make(map[string][]cassetteRecord),
+		replayed: make(map[string]int),
+	}
+	switch mode {
+	case CassetteRecord:
+		if err := os.WriteFile(filename, nil, 0644); err != nil {
+			return nil, utils.Wrap(err, "failed to create cassette file")
+		}
+	case CassetteReplay, CassetteRecordNew:
+		if err := c.load(); err != nil {
+			return nil, err
+		}
+	default:
+		panic("unrecognised cassette mode")
+	}
+	return c, nil
+}
+
+type cassetteModel struct {
+	model    jpf.Model
+	filename string
+	mode     CassetteMode
+	lock     sync.Mutex
+	records  map[string][]cassetteRecord
+	replayed map[string]int
+}
+
+type cassetteRequest struct {
+	Messages     []utils.JsonMessage `json:"messages"`
+	OutputFormat any                 `json:"output_format,omitempty"`
+	Tools        []cassetteTool      `json:"tools,omitempty"`
+}
+
+type cassetteTool struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Args        []cassetteToolArg `json:"args,omitempty"`
+}
+
+type cassetteToolArg struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Type        string `json:"type"`
+	Required    bool   `json:"required"`
+}
+
+type cassetteRecord struct {
+	Request  cassetteRequest   `json:"request"`
+	Chunks   []string          `json:"chunks,omitempty"`
+	Response utils.JsonMessage `json:"response"`
+	Usage    cassetteUsage     `json:"usage"`
+}
+
+type cassetteUsage struct {
+	InputTokens     int `json:"input_tokens"`
+	OutputTokens    int `json:"output_tokens"`
+	SuccessfulCalls int `json:"successful_calls"`
+	FailedCalls     int `json:"failed_calls"`
+}
+
+func (c *cassetteModel) Respond(ctx context.Context, msgs []jpf.Message, opts ...jpf.ModelResponseOpt) (jpf.ModelResponse, error) {
+	kwargs := jpf.GetModelResponseKwargs(opts...)
+	req, err := cassetteRequestFrom(msgs, kwargs)
+	if err != nil {
+		return jpf.ModelResponse{}, utils.Wrap(err, "failed to convert request to cassette format")
+	}
+	key, err := req.key()
+	if err != nil {
+		return jpf.ModelResponse{}, err
+	}
+	if c.mode != CassetteRecord {
+		if rec, ok := c.next(key); ok {
+			return rec.replay(kwargs.Streamer)
+		}
+		if c.mode == CassetteReplay {
+			return jpf.ModelResponse{}, utils.Wrap(ErrCassetteMiss, "unmatched request: %s", key)
+		}
+	}
+	return c.record(ctx, key, req, msgs, opts, kwargs.Streamer)
+}
+
+// next finds the next recording to replay for the request key.
+func (c *cassetteModel) next(key string) (cassetteRecord, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	recs := c.records[key]
+	if len(recs) == 0 {
+		return cassetteRecord{}, false
+	}
+	i := min(c.replayed[key], len(recs)-1)
+	c.replayed[key]++
+	return recs[i], true
+}
+
+func (c *cassetteModel) record(ctx context.Context, key string, req cassetteRequest, msgs []jpf.Message, opts []jpf.ModelResponseOpt, streamer jpf.ModelStreamer) (jpf.ModelResponse, error) {
+	var recorder *chunkRecorder
+	if streamer != nil {
+		recorder = &chunkRecorder{streamer: streamer}
+		opts = append(opts[:len(opts):len(opts)], jpf.WithStreamResponse(recorder))
+	}
+	resp, err := c.model.Respond(ctx, msgs, opts...)
+	if err != nil {
+		return resp, err
+	}
+	respJson, err := utils.MessageToJson(resp.Message)
+	if err != nil {
+		return resp.OnlyUsage(), utils.Wrap(err, "failed to convert response to cassette format")
+	}
+	rec := cassetteRecord{
+		Request:  req,
+		Response: respJson,
+		Usage:    cassetteUsage(resp.Usage),
+	}
+	if recorder != nil {
+		rec.Chunks = recorder.chunks
+	}
+	if err := c.append(key, rec); err != nil {
+		return resp.OnlyUsage(), err
+	}
+	return resp, nil
+}
+
+func (c *cassetteModel) append(key string, rec cassetteRecord) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return utils.Wrap(err, "failed to encode cassette record")
+	}
+	f, err := os.OpenFile(c.filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return utils.Wrap(err, "failed to open cassette file")
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return utils.Wrap(err, "failed to write to cassette file")
+	}
+	c.records[key] = append(c.records[key], rec)
+	c.replayed[key]++
+	return nil
+}
+
+func (c *cassetteModel) load() error {
+	f, err := os.Open(c.filename)
+	if err != nil {
+		if os.IsNotExist(err) && c.mode == CassetteRecordNew {
+			return nil
+		}
+		return utils.Wrap(err, "failed to open cassette file")
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64*1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec cassetteRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return utils.Wrap(err, "failed to decode cassette record on line %d", lineNum)
+		}
+		key, err := rec.Request.key()
+		if err != nil {
+			return err
+		}
+		c.records[key] = append(c.records[key], rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return utils.Wrap(err, "failed to read cassette file")
+	}
+	return nil
+}
+
+func (rec cassetteRecord) replay(streamer jpf.ModelStreamer) (jpf.ModelResponse, error) {
+	msg, err := utils.MessageFromJson(rec.Response)
+	if err != nil {
+		return jpf.ModelResponse{}, utils.Wrap(err, "failed to convert cassette response")
+	}
+	asst, ok := msg.(jpf.AssistantMessage)
+	if !ok {
+		return jpf.ModelResponse{}, fmt.Errorf("cassette response had role '%s', expected 'assistant'", rec.Response.Role)
+	}
+	if streamer != nil {
+		streamer.OnMessageBegin()
+		if rec.Chunks == nil {
+			streamer.OnMessageText(asst.Content)
+		}
+		for _, chunk := range rec.Chunks {
+			streamer.OnMessageText(chunk)
+		}
+	}
+	return jpf.ModelResponse{Message: asst, Usage: jpf.Usage(rec.Usage)}, nil
+}
+
+func cassetteRequestFrom(msgs []jpf.Message, kwargs jpf.ModelResponseKwargs) (cassetteRequest, error) {
+	jsonMsgs, err := utils.MessagesToJson(msgs)
+	if err != nil {
+		return cassetteRequest{}, err
+	}
+	req := cassetteRequest{Messages: jsonMsgs}
+	if kwargs.OutputFormat != nil {
+		r := &jsonschema.Reflector{
+			BaseSchemaID:   "Anonymous",
+			Anonymous:      true,
+			DoNotReference: true,
+		}
+		req.OutputFormat = r.Reflect(kwargs.OutputFormat)
+	}
+	for _, tool := range kwargs.ToolSchemas {
+		ct := cassetteTool{Name: tool.Name, Description: tool.Description}
+		for _, arg := range tool.Args {
+			ct.Args = append(ct.Args, cassetteToolArg{
+				Name:        arg.Name,
+				Description: arg.Description,
+				Type:        cassetteToolArgType(arg.Type),
+				Required:    arg.Required,
+			})
+		}
+		req.Tools = append(req.Tools, ct)
+	}
+	return req, nil
+}
+
+// key is the canonical json encoding of the request, used to match requests against recordings.
+// The request is round-tripped through json first, so that recordings loaded from a file match live requests exactly.
+func (req cassetteRequest) key() (string, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", utils.Wrap(err, "failed to encode cassette request")
+	}
+	var generic any
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return "", utils.Wrap(err, "failed to decode cassette request")
+	}
+	data, err = json.Marshal(generic)
+	if err != nil {
+		return "", utils.Wrap(err, "failed to encode cassette request")
+	}
+	return string(data), nil
+}
+
+func cassetteToolArgType(t jpf.ToolArgType) string {
+	switch t {
+	case jpf.ToolArgInt:
+		return "integer"
+	case jpf.ToolArgFloat:
+		return "number"
+	case jpf.ToolArgString:
+		return "string"
+	default:
+		panic("unreachable")
+	}
+}
+
+// chunkRecorder forwards streamed text to another streamer while keeping a copy of the chunks of the current message.
+type chunkRecorder struct {
+	streamer jpf.ModelStreamer
+	chunks   []string
+}
+
+func (r *chunkRecorder) OnMessageBegin() {
+	r.chunks = []string{}
+	r.streamer.OnMessageBegin()
+}
+
+func (r *chunkRecorder) OnMessageText(text string) {
+	r.chunks = append(r.chunks, text)
+	r.streamer.OnMessageText(text)
+}
+
+func (r *chunkRecorder) OnMessageReset() {
+	r.chunks = nil
+	r.streamer.OnMessageReset()
+}
@@ -2,7 +2,12 @@ package models
 
 import (
 	"context"
+	"errors"
+	"path/filepath"
 	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -53,6 +58,145 @@ func TestCachedModel(t *testing.T) {
 	}
 }
 
+type countingSlowModel struct {
+	calls atomic.Int32
+	delay time.Duration
+}
+
+func (m *countingSlowModel) Respond(ctx context.Context, msgs []jpf.Message, opts ...jpf.ModelResponseOpt) (jpf.ModelResponse, error) {
+	kwargs := jpf.GetModelResponseKwargs(opts...)
+	m.calls.Add(1)
+	if kwargs.Streamer != nil {
+		kwargs.Streamer.OnMessageBegin()
+		kwargs.Streamer.OnMessageText("hel")
+	}
+	select {
+	case <-time.After(m.delay):
+	case <-ctx.Done():
+		return jpf.ModelResponse{}, ctx.Err()
+	}
+	if kwargs.Streamer != nil {
+		kwargs.Streamer.OnMessageText("lo")
+	}
+	return jpf.ModelResponse{
+		Message: jpf.AssistantMessage{Content: "hello"},
+		Usage:   jpf.Usage{InputTokens: 10, OutputTokens: 5, SuccessfulCalls: 1},
+	}, nil
+}
+
+type bufferStreamer struct {
+	buf strings.Builder
+}
+
+func (b *bufferStreamer) OnMessageBegin()           { b.buf.Reset() }
+func (b *bufferStreamer) OnMessageText(text string) { b.buf.WriteString(text) }
+func (b *bufferStreamer) OnMessageReset()           { b.buf.Reset() }
+
+func TestCachedModelCoalescing(t *testing.T) {
+	inner := &countingSlowModel{delay: 50 * time.Millisecond}
+	counter := NewUsageCounter()
+	model := Cache(inner, caches.NewRAM())
+	const n = 50
+	streamers := make([]*bufferStreamer, n)
+	errs := make([]error, n)
+	wg := &sync.WaitGroup{}
+	for i := range n {
+		streamers[i] = &bufferStreamer{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := model.Respond(
+				context.Background(),
+				[]jpf.Message{jpf.UserMessage{Content: "hi"}},
+				jpf.WithStreamResponse(streamers[i]),
+			)
+			counter.Add(resp.Usage)
+			if err == nil && resp.Message.Content != "hello" {
+				err = errors.New("unexpected response: " + resp.Message.Content)
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		t.Fatal(err)
+	}
+	if calls := inner.calls.Load(); calls != 1 {
+		t.Fatalf("expected 1 underlying call, got %d", calls)
+	}
+	if usage := counter.Get(); usage.SuccessfulCalls != 1 || usage.InputTokens != 10 {
+		t.Fatalf("expected usage of exactly one call, got %+v", usage)
+	}
+	for i, s := range streamers {
+		if s.buf.String() != "hello" {
+			t.Fatalf("streamer %d received '%s', expected 'hello'", i, s.buf.String())
+		}
+	}
+}
+
+func TestCachedModelCoalescingCancelledLeader(t *testing.T) {
+	inner := &countingSlowModel{delay: 50 * time.Millisecond}
+	model := Cache(inner, caches.NewRAM())
+	msgs := []jpf.Message{jpf.UserMessage{Content: "hi"}}
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leaderDone := make(chan error)
+	go func() {
+		_, err := model.Respond(leaderCtx, msgs)
+		leaderDone <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	followerDone := make(chan error)
+	go func() {
+		_, err := model.Respond(context.Background(), msgs)
+		followerDone <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-leaderDone; err == nil {
+		t.Fatal("expected cancelled leader to error")
+	}
+	if err := <-followerDone; err != nil {
+		t.Fatalf("expected follower to take over after leader cancelled, got %v", err)
+	}
+	if calls := inner.calls.Load(); calls != 2 {
+		t.Fatalf("expected 2 underlying calls, got %d", calls)
+	}
+}
+
+// missOnceCache reports a miss on the first lookup, as if another caller filled the cache just after it.
+type missOnceCache struct {
+	jpf.ModelResponseCache
+	missed atomic.Bool
+}
+
+func (c *missOnceCache) GetCachedResponse(ctx context.Context, salt string, inputs []jpf.Message) (bool, jpf.AssistantMessage, error) {
+	if c.missed.CompareAndSwap(false, true) {
+		return false, jpf.AssistantMessage{}, nil
+	}
+	return c.ModelResponseCache.GetCachedResponse(ctx, salt, inputs)
+}
+
+func TestCachedModelLeaderChecksCache(t *testing.T) {
+	inner := &countingSlowModel{delay: time.Millisecond}
+	msgs := []jpf.Message{jpf.UserMessage{Content: "hi"}}
+	cache := caches.NewRAM()
+	if err := cache.SetCachedResponse(context.Background(), "", msgs, jpf.AssistantMessage{Content: "cached"}); err != nil {
+		t.Fatal(err)
+	}
+	model := Cache(inner, &missOnceCache{ModelResponseCache: cache})
+	streamer := &bufferStreamer{}
+	resp, err := model.Respond(context.Background(), msgs, jpf.WithStreamResponse(streamer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Message.Content != "cached" || streamer.buf.String() != "cached" {
+		t.Fatalf("expected the cached response to be returned and streamed, got '%s' and '%s'", resp.Message.Content, streamer.buf.String())
+	}
+	if calls := inner.calls.Load(); calls != 0 {
+		t.Fatalf("expected no underlying calls, got %d", calls)
+	}
+}
+
 func TestLoggingModel(t *testing.T) {
 	responseSeq := []string{"hi", "bye", "hi again"}
 	var model jpf.Model = &utils.TestingModel{Responses: map[string][]string{
@@ -344,3 +488,62 @@ func findSubstring(s, substr string) bool {
 	}
 	return false
 }
+
+func TestCassetteModel(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "cassette.jsonl")
+	msgs := []jpf.Message{jpf.SystemMessage{Content: "hello"}}
+	schema := jpf.ToolSchema{Name: "ping", Args: []jpf.ToolArg{{Name: "a", Type: jpf.ToolArgInt}}}
+
+	recorder, err := Cassette(&utils.TestingModel{Responses: map[string][]string{
+		"hello": {"hi", "bye"},
+	}}, filename, CassetteRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := recorder.Respond(context.Background(), msgs, jpf.WithStreamResponse(&bufferStreamer{})); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := recorder.Respond(context.Background(), msgs, jpf.WithToolSchemas(schema)); err != nil {
+		t.Fatal(err)
+	}
+
+	replayer, err := Cassette(nil, filename, CassetteReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamer := &bufferStreamer{}
+	resp, err := replayer.Respond(context.Background(), msgs, jpf.WithStreamResponse(streamer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Message.Content != "hi" || streamer.buf.String() != "hi" {
+		t.Fatalf("expected 'hi' to be replayed and streamed, got '%s' and '%s'", resp.Message.Content, streamer.buf.String())
+	}
+	resp, err = replayer.Respond(context.Background(), msgs, jpf.WithToolSchemas(schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Message.Content != "bye" {
+		t.Fatalf("expected 'bye' to be replayed for the request with tools, got '%s'", resp.Message.Content)
+	}
+	_, err = replayer.Respond(context.Background(), []jpf.Message{jpf.SystemMessage{Content: "unseen"}})
+	if !errors.Is(err, ErrCassetteMiss) {
+		t.Fatalf("expected ErrCassetteMiss, got %v", err)
+	}
+
+	recordNew, err := Cassette(&utils.TestingModel{Responses: map[string][]string{
+		"unseen": {"new"},
+	}}, filename, CassetteRecordNew)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, req := range []struct{ content, expected string }{{"hello", "hi"}, {"unseen", "new"}, {"unseen", "new"}} {
+		resp, err := recordNew.Respond(context.Background(), []jpf.Message{jpf.SystemMessage{Content: req.content}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Message.Content != req.expected {
+			t.Fatalf("expected '%s' got '%s'", req.expected, resp.Message.Content)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package jpf
 
-import "errors"
+import (
+	"context"
+	"errors"
+)
 
 var (
 	ErrInvalidResponse = errors.New("llm produced an invalid response")
@@ -18,7 +21,97 @@ type Validator[T, U any] interface {
 	ValidateParsedResponse(T, U) error
 }
 
+// ContextParser is a [Parser] that may be slow (for example, because it calls a model), so accepts a context and reports its usage.
+// Pipelines call ParseResponseTextContext instead of ParseResponseText when a parser implements it, adding the usage to their totals.
+type ContextParser[U any] interface {
+	Parser[U]
+	ParseResponseTextContext(context.Context, string) (U, Usage, error)
+}
+
+// ContextValidator is a [Validator] that may be slow (for example, because it calls a model), so accepts a context and reports its usage.
+// Pipelines call ValidateParsedResponseContext instead of ValidateParsedResponse when a validator implements it, adding the usage to their totals.
+type ContextValidator[T, U any] interface {
+	Validator[T, U]
+	ValidateParsedResponseContext(context.Context, T, U) (Usage, error)
+}
+
 // FeedbackGenerator takes an error and converts it to a piece of text feedback to send to the LLM.
 type FeedbackGenerator interface {
 	FormatFeedback(AssistantMessage, error) string
 }
+
+// AttemptFeedbackGenerator is a [FeedbackGenerator] that also takes the number of the attempt that failed, starting at 1.
+// Pipelines call FormatAttemptFeedback instead of FormatFeedback when a feedback generator implements it.
+type AttemptFeedbackGenerator interface {
+	FeedbackGenerator
+	FormatAttemptFeedback(msg AssistantMessage, err error, attempt int) string
+}
+
+// ParserWithContext adapts a [Parser] to a [ContextParser].
+// If the parser is already a ContextParser it is returned unchanged, otherwise the context is ignored and no usage is reported.
+func ParserWithContext[U any](parser Parser[U]) ContextParser[U] {
+	if cp, ok := parser.(ContextParser[U]); ok {
+		return cp
+	}
+	return &contextlessParser[U]{parser}
+}
+
+type contextlessParser[U any] struct {
+	Parser[U]
+}
+
+func (p *contextlessParser[U]) ParseResponseTextContext(_ context.Context, response string) (U, Usage, error) {
+	result, err := p.ParseResponseText(response)
+	return result, Usage{}, err
+}
+
+// ValidatorWithContext adapts a [Validator] to a [ContextValidator].
+// If the validator is already a ContextValidator it is returned unchanged, otherwise the context is ignored and no usage is reported.
+func ValidatorWithContext[T, U any](validator Validator[T, U]) ContextValidator[T, U] {
+	if cv, ok := validator.(ContextValidator[T, U]); ok {
+		return cv
+	}
+	return &contextlessValidator[T, U]{validator}
+}
+
+type contextlessValidator[T, U any] struct {
+	Validator[T, U]
+}
+
+func (v *contextlessValidator[T, U]) ValidateParsedResponseContext(_ context.Context, input T, output U) (Usage, error) {
+	return Usage{}, v.ValidateParsedResponse(input, output)
+}
+
+// NewContextParser creates a [ContextParser] from a function.
+// When used as a plain [Parser], the function is called with context.Background and the usage is discarded.
+func NewContextParser[U any](parse func(context.Context, string) (U, Usage, error)) ContextParser[U] {
+	return contextParserFunc[U](parse)
+}
+
+type contextParserFunc[U any] func(context.Context, string) (U, Usage, error)
+
+func (f contextParserFunc[U]) ParseResponseText(response string) (U, error) {
+	result, _, err := f(context.Background(), response)
+	return result, err
+}
+
+func (f contextParserFunc[U]) ParseResponseTextContext(ctx context.Context, response string) (U, Usage, error) {
+	return f(ctx, response)
+}
+
+// NewContextValidator creates a [ContextValidator] from a function.
+// When used as a plain [Validator], the function is called with context.Background and the usage is discarded.
+func NewContextValidator[T, U any](validate func(context.Context, T, U) (Usage, error)) ContextValidator[T, U] {
+	return contextValidatorFunc[T, U](validate)
+}
+
+type contextValidatorFunc[T, U any] func(context.Context, T, U) (Usage, error)
+
+func (f contextValidatorFunc[T, U]) ValidateParsedResponse(input T, output U) error {
+	_, err := f(context.Background(), input, output)
+	return err
+}
+
+func (f contextValidatorFunc[T, U]) ValidateParsedResponseContext(ctx context.Context, input T, output U) (Usage, error) {
+	return f(ctx, input, output)
+}
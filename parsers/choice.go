@@ -0,0 +1,215 @@
+package parsers
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/internal/utils"
+)
+
+// NewChoice creates a [Parser] that classifies the response as one of the allowed labels.
+// T may be string, or a string based enum type, for example NewChoice([]Sentiment{Positive, Negative}).
+// Matching ignores case and punctuation, so "Positive." matches "positive".
+// If the response is not exactly a label, the labels (and aliases, see [WithAlias]) contained in it are used, preferring longer phrases,
+// so "positive sentiment" matches "positive" and "very positive" matches "very positive" over "positive".
+// Edit distance matching of misspelled labels can be enabled with [WithMaxEditDistance].
+// If no label matches, or more than one label matches equally well, an error listing the allowed labels is returned, joined with [jpf.ErrInvalidResponse].
+// NewChoice panics if there are no labels, or an alias refers to a label that is not allowed.
+func NewChoice[T ~string](labels []T, opts ...ChoiceOpt) jpf.Parser[T] {
+	if len(labels) == 0 {
+		panic("NewChoice: at least one label is required")
+	}
+	settings := choiceSettings{}
+	for _, o := range opts {
+		o(&settings)
+	}
+	p := &choiceParser[T]{
+		labels:          labels,
+		maxEditDistance: settings.maxEditDistance,
+	}
+	for _, l := range labels {
+		p.phrases = append(p.phrases, choicePhrase[T]{words: normaliseChoice(string(l)), label: l})
+	}
+	for _, a := range settings.aliases {
+		i := slices.Index(labels, T(a.label))
+		if i == -1 {
+			panic(fmt.Sprintf("NewChoice: alias %q refers to unknown label %q", a.alias, a.label))
+		}
+		p.phrases = append(p.phrases, choicePhrase[T]{words: normaliseChoice(a.alias), label: labels[i]})
+	}
+	return p
+}
+
+type ChoiceOpt func(*choiceSettings)
+
+type choiceSettings struct {
+	aliases         []choiceAlias
+	maxEditDistance int
+}
+
+type choiceAlias struct {
+	label, alias string
+}
+
+// Also accept any of the aliases as meaning the label.
+func WithAlias(label string, aliases ...string) ChoiceOpt {
+	return func(s *choiceSettings) {
+		for _, a := range aliases {
+			s.aliases = append(s.aliases, choiceAlias{label, a})
+		}
+	}
+}
+
+// Accept labels (or aliases) that are misspelled by up to maxDistance single character edits.
+// By default, only exact matches (ignoring case and punctuation) are accepted.
+func WithMaxEditDistance(maxDistance int) ChoiceOpt {
+	return func(s *choiceSettings) { s.maxEditDistance = maxDistance }
+}
+
+type choiceParser[T ~string] struct {
+	labels          []T
+	phrases         []choicePhrase[T]
+	maxEditDistance int
+}
+
+type choicePhrase[T ~string] struct {
+	words []string
+	label T
+}
+
+func (p *choiceParser[T]) ParseResponseText(response string) (T, error) {
+	words := normaliseChoice(response)
+	// The whole response is a label
+	for _, ph := range p.phrases {
+		if slices.Equal(ph.words, words) {
+			return ph.label, nil
+		}
+	}
+	// The response contains labels
+	contained := []choicePhrase[T]{}
+	for _, ph := range p.phrases {
+		if containsWords(words, ph.words) {
+			contained = append(contained, ph)
+		}
+	}
+	contained = slices.DeleteFunc(slices.Clone(contained), func(ph choicePhrase[T]) bool {
+		return slices.ContainsFunc(contained, func(other choicePhrase[T]) bool {
+			return len(other.words) > len(ph.words) && containsWords(other.words, ph.words)
+		})
+	})
+	if label, ok, err := p.unique(contained, response); ok || err != nil {
+		return label, err
+	}
+	// The response contains misspelled labels
+	if p.maxEditDistance > 0 {
+		best, bestDistance := []choicePhrase[T]{}, p.maxEditDistance+1
+		for _, ph := range p.phrases {
+			d := closestWindowDistance(words, ph.words)
+			if d < bestDistance {
+				best, bestDistance = []choicePhrase[T]{ph}, d
+			} else if d == bestDistance {
+				best = append(best, ph)
+			}
+		}
+		if label, ok, err := p.unique(best, response); ok || err != nil {
+			return label, err
+		}
+	}
+	var zero T
+	return zero, utils.Wrap(jpf.ErrInvalidResponse, "response %q did not match any of the allowed options, respond with exactly one of: %s", strings.TrimSpace(response), p.options())
+}
+
+// unique returns the label of the matched phrases if they all have the same label, or an error if they are ambiguous.
+func (p *choiceParser[T]) unique(matched []choicePhrase[T], response string) (T, bool, error) {
+	var zero T
+	if len(matched) == 0 {
+		return zero, false, nil
+	}
+	labels := []T{}
+	for _, ph := range matched {
+		if !slices.Contains(labels, ph.label) {
+			labels = append(labels, ph.label)
+		}
+	}
+	if len(labels) == 1 {
+		return labels[0], true, nil
+	}
+	names := make([]string, len(labels))
+	for i, l := range labels {
+		names[i] = string(l)
+	}
+	return zero, false, utils.Wrap(
+		jpf.ErrInvalidResponse,
+		"response %q was ambiguous, as it could mean any of %s, respond with exactly one of: %s",
+		strings.TrimSpace(response), strings.Join(names, ", "), p.options(),
+	)
+}
+
+func (p *choiceParser[T]) options() string {
+	names := make([]string, len(p.labels))
+	for i, l := range p.labels {
+		names[i] = string(l)
+	}
+	return strings.Join(names, ", ")
+}
+
+// normaliseChoice lowercases the text and splits it into words, ignoring punctuation.
+func normaliseChoice(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// containsWords reports whether the phrase appears as a contiguous sequence of whole words.
+func containsWords(words, phrase []string) bool {
+	if len(phrase) == 0 {
+		return false
+	}
+	for i := 0; i+len(phrase) <= len(words); i++ {
+		if slices.Equal(words[i:i+len(phrase)], phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// closestWindowDistance finds the smallest edit distance between the phrase and any run of the same number of words.
+func closestWindowDistance(words, phrase []string) int {
+	target := strings.Join(phrase, " ")
+	best := -1
+	for i := 0; i+len(phrase) <= len(words); i++ {
+		d := editDistance(strings.Join(words[i:i+len(phrase)], " "), target)
+		if best == -1 || d < best {
+			best = d
+		}
+	}
+	if best == -1 {
+		return editDistance(strings.Join(words, " "), target)
+	}
+	return best
+}
+
+// editDistance calculates the levenshtein distance between two strings, in runes.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,149 @@
+package parsers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/internal/utils"
+)
+
+// OneOf creates a [Parser] that tries each parser in order, returning the result of the first that succeeds.
+// If every parser returns an invalid response, the errors from all of them are joined together with [jpf.ErrInvalidResponse].
+// If a parser returns any other error, trying stops and that error is returned.
+func OneOf[T any](parsers ...jpf.Parser[T]) jpf.Parser[T] {
+	return &oneOfParser[T]{parsers: parsers}
+}
+
+type oneOfParser[T any] struct {
+	parsers []jpf.Parser[T]
+}
+
+func (p *oneOfParser[T]) ParseResponseText(response string) (T, error) {
+	result, _, err := p.ParseResponseTextContext(context.Background(), response)
+	return result, err
+}
+
+func (p *oneOfParser[T]) ParseResponseTextContext(ctx context.Context, response string) (T, jpf.Usage, error) {
+	var zero T
+	totalUsage := jpf.Usage{}
+	errs := []error{}
+	for i, parser := range p.parsers {
+		result, usage, err := jpf.ParserWithContext(parser).ParseResponseTextContext(ctx, response)
+		totalUsage = totalUsage.Add(usage)
+		if err == nil {
+			return result, totalUsage, nil
+		}
+		if !errors.Is(err, jpf.ErrInvalidResponse) {
+			return zero, totalUsage, err
+		}
+		errs = append(errs, fmt.Errorf("format %d: %w", i+1, err))
+	}
+	return zero, totalUsage, utils.Wrap(errors.Join(append(errs, jpf.ErrInvalidResponse)...), "response was not in any of the %d accepted formats", len(p.parsers))
+}
+
+// Map creates a [Parser] that transforms the result of another parser with the function.
+// Errors from the function are returned unchanged, so it should join them with [jpf.ErrInvalidResponse] if the model should retry.
+func Map[T, U any](parser jpf.Parser[T], transform func(T) (U, error)) jpf.Parser[U] {
+	return &mapParser[T, U]{parser: parser, transform: transform}
+}
+
+type mapParser[T, U any] struct {
+	parser    jpf.Parser[T]
+	transform func(T) (U, error)
+}
+
+func (p *mapParser[T, U]) ParseResponseText(response string) (U, error) {
+	result, _, err := p.ParseResponseTextContext(context.Background(), response)
+	return result, err
+}
+
+func (p *mapParser[T, U]) ParseResponseTextContext(ctx context.Context, response string) (U, jpf.Usage, error) {
+	result, usage, err := jpf.ParserWithContext(p.parser).ParseResponseTextContext(ctx, response)
+	if err != nil {
+		var zero U
+		return zero, usage, err
+	}
+	transformed, err := p.transform(result)
+	return transformed, usage, err
+}
+
+// Each creates a [Parser] that splits the response into parts, then parses every part with the parser.
+// If any parts are invalid responses, the errors from all of them are joined together with [jpf.ErrInvalidResponse].
+// If the parser returns any other error, parsing stops and that error is returned.
+func Each[T any](parser jpf.Parser[T], split func(string) []string) jpf.Parser[[]T] {
+	return &eachParser[T]{parser: parser, split: split}
+}
+
+// EachLine creates a [Parser] like [Each], that parses every non-blank line of the response.
+func EachLine[T any](parser jpf.Parser[T]) jpf.Parser[[]T] {
+	return Each(parser, func(s string) []string {
+		lines := []string{}
+		for _, line := range strings.Split(s, "\n") {
+			if strings.TrimSpace(line) != "" {
+				lines = append(lines, line)
+			}
+		}
+		return lines
+	})
+}
+
+type eachParser[T any] struct {
+	parser jpf.Parser[T]
+	split  func(string) []string
+}
+
+func (p *eachParser[T]) ParseResponseText(response string) ([]T, error) {
+	result, _, err := p.ParseResponseTextContext(context.Background(), response)
+	return result, err
+}
+
+func (p *eachParser[T]) ParseResponseTextContext(ctx context.Context, response string) ([]T, jpf.Usage, error) {
+	parser := jpf.ParserWithContext(p.parser)
+	parts := p.split(response)
+	results := make([]T, len(parts))
+	totalUsage := jpf.Usage{}
+	errs := []error{}
+	for i, part := range parts {
+		result, usage, err := parser.ParseResponseTextContext(ctx, part)
+		totalUsage = totalUsage.Add(usage)
+		if err != nil {
+			if !errors.Is(err, jpf.ErrInvalidResponse) {
+				return nil, totalUsage, err
+			}
+			errs = append(errs, fmt.Errorf("part %d: %w", i+1, err))
+			continue
+		}
+		results[i] = result
+	}
+	if len(errs) > 0 {
+		return nil, totalUsage, utils.Wrap(errors.Join(append(errs, jpf.ErrInvalidResponse)...), "%d of %d parts of the response were invalid", len(errs), len(parts))
+	}
+	return results, totalUsage, nil
+}
+
+// WithDefault creates a [Parser] that returns the default value instead of an invalid response error.
+// Any other error is still returned.
+func WithDefault[T any](parser jpf.Parser[T], defaultValue T) jpf.Parser[T] {
+	return &defaultParser[T]{parser: parser, defaultValue: defaultValue}
+}
+
+type defaultParser[T any] struct {
+	parser       jpf.Parser[T]
+	defaultValue T
+}
+
+func (p *defaultParser[T]) ParseResponseText(response string) (T, error) {
+	result, _, err := p.ParseResponseTextContext(context.Background(), response)
+	return result, err
+}
+
+func (p *defaultParser[T]) ParseResponseTextContext(ctx context.Context, response string) (T, jpf.Usage, error) {
+	result, usage, err := jpf.ParserWithContext(p.parser).ParseResponseTextContext(ctx, response)
+	if errors.Is(err, jpf.ErrInvalidResponse) {
+		return p.defaultValue, usage, nil
+	}
+	return result, usage, err
+}
@@ -0,0 +1,112 @@
+package parsers
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType            = reflect.TypeFor[time.Time]()
+	durationType        = reflect.TypeFor[time.Duration]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// timeLayouts are the layouts tried, in order, when converting text to a time.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// canSetFromText reports whether setFromText supports values of the type.
+func canSetFromText(typ reflect.Type) bool {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	switch {
+	case typ == timeType, typ == durationType, reflect.PointerTo(typ).Implements(textUnmarshalerType):
+		return true
+	}
+	switch typ.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// setFromText converts the text to the type of v and stores it in v, which must be settable.
+// Errors are phrased so that they can be passed back to an LLM as feedback.
+func setFromText(v reflect.Value, text string) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setFromText(v.Elem(), text)
+	}
+	text = strings.TrimSpace(text)
+	switch {
+	case v.Type() == timeType:
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, text); err == nil {
+				v.Set(reflect.ValueOf(t))
+				return nil
+			}
+		}
+		return fmt.Errorf("%q is not a valid time, use the format YYYY-MM-DD or YYYY-MM-DDTHH:MM:SSZ", text)
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return fmt.Errorf("%q is not a valid duration, use a format like 1h30m or 45s", text)
+		}
+		v.SetInt(int64(d))
+		return nil
+	case reflect.PointerTo(v.Type()).Implements(textUnmarshalerType):
+		if err := v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text)); err != nil {
+			return fmt.Errorf("%q is not valid: %w", text, err)
+		}
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(text)
+	case reflect.Bool:
+		switch strings.ToLower(text) {
+		case "true", "yes", "y", "1":
+			v.SetBool(true)
+		case "false", "no", "n", "0":
+			v.SetBool(false)
+		default:
+			return fmt.Errorf("%q is not a valid boolean, use true or false", text)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(text, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not a valid integer", text)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(text, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not a valid non-negative integer", text)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(text, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not a valid number", text)
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("cannot convert text to %s", v.Type())
+	}
+	return nil
+}
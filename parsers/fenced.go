@@ -0,0 +1,93 @@
+package parsers
+
+import (
+	"slices"
+	"strings"
+)
+
+// codeBlock is a fenced code block from a markdown document.
+type codeBlock struct {
+	language string
+	code     string
+}
+
+// markdownCodeBlocks finds the fenced code blocks (``` or ~~~) in the text, in order.
+// It also reports whether the text ended inside a block that was never closed, which is not included.
+func markdownCodeBlocks(text string) ([]codeBlock, bool) {
+	blocks := []codeBlock{}
+	lines := strings.SplitAfter(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		fence, info, ok := openingFence(lines[i])
+		if !ok {
+			continue
+		}
+		code := &strings.Builder{}
+		closed := false
+		for i++; i < len(lines); i++ {
+			if isClosingFence(lines[i], fence) {
+				closed = true
+				break
+			}
+			code.WriteString(lines[i])
+		}
+		if !closed {
+			return blocks, true
+		}
+		blocks = append(blocks, codeBlock{language: fenceLanguage(info), code: code.String()})
+	}
+	return blocks, false
+}
+
+// openingFence checks if the line opens a code block, returning the fence and the info string.
+func openingFence(line string) (string, string, bool) {
+	trimmed := strings.TrimRight(line, "\r\n")
+	indented := strings.TrimLeft(trimmed, " ")
+	if len(trimmed)-len(indented) > 3 || len(indented) < 3 || (indented[0] != '`' && indented[0] != '~') {
+		return "", "", false
+	}
+	n := len(indented) - len(strings.TrimLeft(indented, indented[:1]))
+	if n < 3 {
+		return "", "", false
+	}
+	fence, info := indented[:n], indented[n:]
+	if fence[0] == '`' && strings.Contains(info, "`") {
+		return "", "", false
+	}
+	return fence, info, true
+}
+
+// isClosingFence checks if the line closes a code block opened with the fence.
+func isClosingFence(line string, fence string) bool {
+	trimmed := strings.TrimRight(line, " \t\r\n")
+	indented := strings.TrimLeft(trimmed, " ")
+	if len(trimmed)-len(indented) > 3 || len(indented) < len(fence) {
+		return false
+	}
+	return strings.Trim(indented, fence[:1]) == ""
+}
+
+// fencedBlock finds the contents of the first fenced code block whose language is one of languages.
+// If there is none, the first block with no language is used instead, and if there are no fenced blocks at all, the whole text is used.
+func fencedBlock(text string, languages ...string) string {
+	blocks, _ := markdownCodeBlocks(text)
+	for _, b := range blocks {
+		if slices.Contains(languages, b.language) {
+			return b.code
+		}
+	}
+	for _, b := range blocks {
+		if b.language == "" {
+			return b.code
+		}
+	}
+	return text
+}
+
+// fenceLanguage returns the lowercase language of a fenced block's info string (the first word).
+func fenceLanguage(info string) string {
+	fields := strings.Fields(info)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToLower(fields[0])
+}
@@ -1,44 +1,175 @@
 package parsers
 
 import (
+	"bytes"
+	"encoding"
 	"encoding/json"
 	"errors"
 	"reflect"
 	"regexp"
+	"strings"
 
 	"github.com/JoshPattman/jpf"
 	"github.com/JoshPattman/jpf/internal/utils"
+	"github.com/invopop/jsonschema"
 )
 
-// NewJson creates a [Parser] that tries to parse a json object from the response.
-// It can ONLY parse json objects with an OBJECT as top level (i.e. it cannot parse a list directly).
+// NewJson creates a [Parser] that tries to parse a json value from the response.
+// T may be a struct, a map with string keys, a slice or array, a string, a bool, a number, or a pointer to any of these.
+// The first complete json value of the right kind is parsed, so for a struct this is the first balanced object,
+// for a slice the first balanced array, and for a number the first number in the response.
+// Any surrounding text (such as an explanation or code fences) is ignored.
 func NewJson[T any]() jpf.Parser[T] {
-	var zero T
-	// Ensure T is either a struct or a map at runtime using reflection
-	{
-		typ := reflect.TypeOf(zero)
-		kind := typ.Kind()
-		if !(kind == reflect.Struct || (kind == reflect.Map && typ.Key().Kind() == reflect.String)) {
-			panic("NewJsonParser: T must be a struct or a map with string keys")
-		}
+	return &jsonParser[T]{
+		extract: jsonExtractorFor[T]("NewJson"),
 	}
-	return &jsonParser[T]{}
 }
 
-type jsonParser[T any] struct{}
+// NewValidatedJson creates a [Parser] like [NewJson], but that also validates the json against the schema reflected from T before decoding it.
+// This catches missing required fields, unknown fields and violations of jsonschema struct tags (enum, minimum, pattern, ...),
+// which would otherwise pass silently. All violations are returned together, joined with [jpf.ErrInvalidResponse],
+// so the model can be told exactly what to fix. As with structured output, fields are required unless they are tagged omitempty.
+func NewValidatedJson[T any]() jpf.Parser[T] {
+	p := NewJson[T]().(*jsonParser[T])
+	p.schema = reflectSchema(*new(T))
+	return p
+}
+
+type jsonParser[T any] struct {
+	extract func(string) (string, bool)
+	schema  *jsonschema.Schema
+}
 
 func (d *jsonParser[T]) ParseResponseText(response string) (T, error) {
-	re := regexp.MustCompile(`(?s)\{.*\}`)
-	match := re.FindString(response)
-	if match == "" {
+	match, ok := d.extract(response)
+	if !ok {
 		var zero T
-		return zero, utils.Wrap(jpf.ErrInvalidResponse, "response did not contain a json object")
+		return zero, utils.Wrap(jpf.ErrInvalidResponse, "response did not contain a json %s", jsonKindName[T]())
+	}
+	if d.schema != nil {
+		if err := d.validate(match); err != nil {
+			var zero T
+			return zero, err
+		}
 	}
 	var result T
 	err := json.Unmarshal([]byte(match), &result)
 	if err != nil {
 		var zero T
-		return zero, utils.Wrap(errors.Join(err, jpf.ErrInvalidResponse), "llm returned an invalid json object")
+		return zero, utils.Wrap(errors.Join(err, jpf.ErrInvalidResponse), "llm returned an invalid json %s", jsonKindName[T]())
 	}
 	return result, nil
 }
+
+func (d *jsonParser[T]) validate(match string) error {
+	dec := json.NewDecoder(bytes.NewBufferString(match))
+	dec.UseNumber()
+	var generic any
+	if err := dec.Decode(&generic); err != nil {
+		return utils.Wrap(errors.Join(err, jpf.ErrInvalidResponse), "llm returned an invalid json %s", jsonKindName[T]())
+	}
+	violations := schemaViolations(generic, d.schema)
+	if len(violations) > 0 {
+		return utils.Wrap(errors.Join(append(violations, jpf.ErrInvalidResponse)...), "llm returned json that did not match the schema")
+	}
+	return nil
+}
+
+var (
+	jsonNumberPattern = regexp.MustCompile(`-?(?:0|[1-9][0-9]*)(?:\.[0-9]+)?(?:[eE][+-]?[0-9]+)?`)
+	jsonBoolPattern   = regexp.MustCompile(`\b(?:true|false)\b`)
+)
+
+// jsonExtractorFor finds the function that extracts the first json value that T decodes from, panicking if T is unsupported.
+func jsonExtractorFor[T any](constructor string) func(string) (string, bool) {
+	typ := jsonTargetType[T]()
+	switch {
+	case reflect.PointerTo(typ).Implements(reflect.TypeFor[encoding.TextUnmarshaler]()):
+		return firstJsonString
+	case typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8:
+		// Byte slices are encoded as base64 strings.
+		return firstJsonString
+	case typ.Kind() == reflect.Struct, typ.Kind() == reflect.Map && typ.Key().Kind() == reflect.String:
+		return func(s string) (string, bool) { return firstCompleteJson(s, '{') }
+	case typ.Kind() == reflect.Slice, typ.Kind() == reflect.Array:
+		return func(s string) (string, bool) { return firstCompleteJson(s, '[') }
+	case typ.Kind() == reflect.String:
+		return firstJsonString
+	case typ.Kind() == reflect.Bool:
+		return func(s string) (string, bool) { return firstJsonMatch(s, jsonBoolPattern) }
+	case typ.Kind() >= reflect.Int && typ.Kind() <= reflect.Float64:
+		return func(s string) (string, bool) { return firstJsonMatch(s, jsonNumberPattern) }
+	default:
+		panic(constructor + ": T must be a struct, a map with string keys, a slice, a string, a bool, a number, or a pointer to one of these")
+	}
+}
+
+// jsonTargetType returns the type that json is decoded into for T, following pointers.
+func jsonTargetType[T any]() reflect.Type {
+	typ := reflect.TypeFor[T]()
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	return typ
+}
+
+// jsonKindName names the kind of json value that T decodes from, for use in errors.
+func jsonKindName[T any]() string {
+	typ := jsonTargetType[T]()
+	switch typ.Kind() {
+	case reflect.Struct, reflect.Map:
+		return "object"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	default:
+		return "number"
+	}
+}
+
+// firstJsonString finds the first complete json string literal in the text.
+func firstJsonString(text string) (string, bool) {
+	for start := strings.IndexByte(text, '"'); start != -1; {
+		end := start + 1
+		for end < len(text) && text[end] != '"' {
+			if text[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(text) {
+			return "", false
+		}
+		candidate := text[start : end+1]
+		if json.Valid([]byte(candidate)) {
+			return candidate, true
+		}
+		next := strings.IndexByte(text[end+1:], '"')
+		if next == -1 {
+			return "", false
+		}
+		start = end + 1 + next
+	}
+	return "", false
+}
+
+// firstJsonMatch finds the first match of the pattern that is not part of a larger word or number.
+func firstJsonMatch(text string, pattern *regexp.Regexp) (string, bool) {
+	for _, loc := range pattern.FindAllStringIndex(text, -1) {
+		if loc[0] > 0 && isIdentByte(text[loc[0]-1]) {
+			continue
+		}
+		if loc[1] < len(text) && isIdentByte(text[loc[1]]) {
+			continue
+		}
+		return text[loc[0]:loc[1]], true
+	}
+	return "", false
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,306 @@
+package parsers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/internal/utils"
+)
+
+// JsonRepair describes a fix applied to json-like text by a repairing parser.
+type JsonRepair string
+
+const (
+	RepairTrailingComma    JsonRepair = "removed a trailing comma"
+	RepairSingleQuotes     JsonRepair = "replaced single quotes with double quotes"
+	RepairControlCharacter JsonRepair = "escaped a newline or other control character inside a string"
+	RepairComment          JsonRepair = "removed a comment"
+	RepairUnquotedKey      JsonRepair = "added quotes around an object key"
+	RepairPythonLiteral    JsonRepair = "replaced True, False or None with true, false or null"
+	RepairUnclosedString   JsonRepair = "closed an unterminated string"
+	RepairMissingValue     JsonRepair = "added null for a key with no value"
+	RepairUnclosedBracket  JsonRepair = "added missing closing brackets"
+)
+
+// NewRepairingJson creates a [Parser] that fixes common mistakes in json-like responses before decoding them.
+// It repairs trailing commas, single quoted strings, unescaped newlines in strings, comments, unquoted keys,
+// python style literals, and responses that were cut off before closing their strings and brackets.
+// By default, repairs are treated as warnings (see [OnRepair]); use [WithRepairsAsErrors] to instead treat them as invalid responses.
+// T must be a struct, a map with string keys, a slice, or a pointer to one of these.
+func NewRepairingJson[T any](opts ...RepairingJsonOpt) jpf.Parser[T] {
+	p := &repairingJsonParser[T]{
+		opener: jsonOpenerFor[T]("NewRepairingJson"),
+	}
+	for _, o := range opts {
+		o(&p.settings)
+	}
+	return p
+}
+
+type RepairingJsonOpt func(*repairingJsonSettings)
+
+type repairingJsonSettings struct {
+	strict   bool
+	onRepair func([]JsonRepair)
+}
+
+// Treat any repair as an invalid response, returning [jpf.ErrInvalidResponse] joined with a description of every mistake found.
+// This still saves a retry being wasted on unhelpful feedback, as the model is told exactly what was wrong.
+func WithRepairsAsErrors() RepairingJsonOpt {
+	return func(s *repairingJsonSettings) { s.strict = true }
+}
+
+// Call the callback with the repairs applied, whenever a response needed repairing.
+func OnRepair(callback func([]JsonRepair)) RepairingJsonOpt {
+	return func(s *repairingJsonSettings) { s.onRepair = callback }
+}
+
+type repairingJsonParser[T any] struct {
+	opener   byte
+	settings repairingJsonSettings
+}
+
+func (p *repairingJsonParser[T]) ParseResponseText(response string) (T, error) {
+	var zero T
+	repaired, repairs, err := repairJson(response, p.opener)
+	if err != nil {
+		return zero, utils.Wrap(errors.Join(err, jpf.ErrInvalidResponse), "llm returned json that could not be repaired")
+	}
+	if len(repairs) > 0 {
+		if p.settings.strict {
+			errs := make([]error, len(repairs))
+			for i, r := range repairs {
+				errs[i] = fmt.Errorf("invalid json: %s", repairMistake(r))
+			}
+			return zero, utils.Wrap(errors.Join(append(errs, jpf.ErrInvalidResponse)...), "llm returned invalid json")
+		}
+		if p.settings.onRepair != nil {
+			p.settings.onRepair(repairs)
+		}
+	}
+	var result T
+	if err := json.Unmarshal([]byte(repaired), &result); err != nil {
+		return zero, utils.Wrap(errors.Join(err, jpf.ErrInvalidResponse), "llm returned an invalid json value")
+	}
+	return result, nil
+}
+
+// repairMistake phrases a repair as the mistake that the model made.
+func repairMistake(r JsonRepair) string {
+	switch r {
+	case RepairTrailingComma:
+		return "there is a trailing comma"
+	case RepairSingleQuotes:
+		return "strings must use double quotes, not single quotes"
+	case RepairControlCharacter:
+		return "newlines and other control characters inside strings must be escaped"
+	case RepairComment:
+		return "comments are not allowed"
+	case RepairUnquotedKey:
+		return "object keys must be quoted"
+	case RepairPythonLiteral:
+		return "use true, false and null instead of True, False and None"
+	case RepairUnclosedString:
+		return "a string was not closed"
+	case RepairMissingValue:
+		return "a key has no value"
+	case RepairUnclosedBracket:
+		return "not every bracket was closed"
+	default:
+		return string(r)
+	}
+}
+
+// jsonRepairer rewrites json-like text into json, keeping track of the repairs it made.
+type jsonRepairer struct {
+	src     string
+	out     strings.Builder
+	stack   []byte
+	repairs []JsonRepair
+}
+
+func (r *jsonRepairer) repaired(repair JsonRepair) {
+	if !slices.Contains(r.repairs, repair) {
+		r.repairs = append(r.repairs, repair)
+	}
+}
+
+// lastSignificant returns the last non-whitespace byte written, or 0 if there is none.
+func (r *jsonRepairer) lastSignificant() byte {
+	s := strings.TrimRight(r.out.String(), " \t\n\r")
+	if s == "" {
+		return 0
+	}
+	return s[len(s)-1]
+}
+
+// trimTrailing removes the final non-whitespace byte written, along with any whitespace after it.
+func (r *jsonRepairer) trimTrailing() {
+	s := strings.TrimRight(r.out.String(), " \t\n\r")
+	r.out.Reset()
+	r.out.WriteString(s[:len(s)-1])
+}
+
+// repairJson repairs the first json value opened by the given bracket, returning the repaired json and the repairs made.
+func repairJson(text string, opener byte) (string, []JsonRepair, error) {
+	start := strings.IndexByte(text, opener)
+	if start == -1 {
+		return "", nil, fmt.Errorf("response did not contain a '%c'", opener)
+	}
+	r := &jsonRepairer{src: text}
+	i := start
+	for i < len(text) {
+		c := text[i]
+		switch {
+		case c == '/' && i+1 < len(text) && text[i+1] == '/':
+			end := strings.IndexByte(text[i:], '\n')
+			if end == -1 {
+				end = len(text) - i
+			}
+			i += end
+			r.repaired(RepairComment)
+		case c == '/' && i+1 < len(text) && text[i+1] == '*':
+			end := strings.Index(text[i+2:], "*/")
+			if end == -1 {
+				i = len(text)
+			} else {
+				i += end + 4
+			}
+			r.repaired(RepairComment)
+		case c == '"' || c == '\'':
+			i = r.string(i)
+		case c == '{' || c == '[':
+			r.stack = append(r.stack, map[byte]byte{'{': '}', '[': ']'}[c])
+			r.out.WriteByte(c)
+			i++
+		case c == '}' || c == ']':
+			if len(r.stack) == 0 || r.stack[len(r.stack)-1] != c {
+				return "", nil, fmt.Errorf("unexpected '%c' at position %d", c, i)
+			}
+			r.closeContainer()
+			i++
+			if len(r.stack) == 0 {
+				return r.out.String(), r.repairs, nil
+			}
+		case isWordByte(c):
+			i = r.word(i)
+		default:
+			r.out.WriteByte(c)
+			i++
+		}
+	}
+	// The response was cut off, so close everything that is still open.
+	for len(r.stack) > 0 {
+		r.closeContainer()
+		r.repaired(RepairUnclosedBracket)
+	}
+	return r.out.String(), r.repairs, nil
+}
+
+// closeContainer writes the closer of the innermost container, first fixing a trailing comma or a key without a value.
+func (r *jsonRepairer) closeContainer() {
+	switch r.lastSignificant() {
+	case ',':
+		r.trimTrailing()
+		r.repaired(RepairTrailingComma)
+	case ':':
+		r.out.WriteString("null")
+		r.repaired(RepairMissingValue)
+	}
+	r.out.WriteByte(r.stack[len(r.stack)-1])
+	r.stack = r.stack[:len(r.stack)-1]
+}
+
+// string copies the string starting at the quote at i, returning the position after it.
+func (r *jsonRepairer) string(i int) int {
+	quote := r.src[i]
+	if quote == '\'' {
+		r.repaired(RepairSingleQuotes)
+	}
+	r.out.WriteByte('"')
+	i++
+	for i < len(r.src) {
+		c := r.src[i]
+		switch {
+		case c == quote:
+			r.out.WriteByte('"')
+			return i + 1
+		case c == '\\' && i+1 < len(r.src):
+			if r.src[i+1] == '\'' {
+				// \' is not a valid json escape, but is how a quote is escaped in a single quoted string
+				r.out.WriteByte('\'')
+			} else {
+				r.out.WriteString(r.src[i : i+2])
+			}
+			i += 2
+		case c == '"':
+			r.out.WriteString(`\"`)
+			i++
+		case c == '\n':
+			r.out.WriteString(`\n`)
+			r.repaired(RepairControlCharacter)
+			i++
+		case c == '\r':
+			r.out.WriteString(`\r`)
+			r.repaired(RepairControlCharacter)
+			i++
+		case c == '\t':
+			r.out.WriteString(`\t`)
+			r.repaired(RepairControlCharacter)
+			i++
+		case c < 0x20:
+			fmt.Fprintf(&r.out, `\u%04x`, c)
+			r.repaired(RepairControlCharacter)
+			i++
+		default:
+			r.out.WriteByte(c)
+			i++
+		}
+	}
+	// A trailing lone backslash would escape the closing quote.
+	if strings.HasSuffix(r.out.String(), `\`) && !strings.HasSuffix(r.out.String(), `\\`) {
+		r.trimTrailing()
+	}
+	r.out.WriteByte('"')
+	r.repaired(RepairUnclosedString)
+	return i
+}
+
+// word copies the bare word (literal, number or unquoted key) starting at i, returning the position after it.
+func (r *jsonRepairer) word(i int) int {
+	end := i
+	for end < len(r.src) && isWordByte(r.src[end]) {
+		end++
+	}
+	word := r.src[i:end]
+	next := end
+	for next < len(r.src) && strings.IndexByte(" \t\n\r", r.src[next]) != -1 {
+		next++
+	}
+	isKey := next < len(r.src) && r.src[next] == ':' && len(r.stack) > 0 && r.stack[len(r.stack)-1] == '}'
+	switch {
+	case isKey:
+		r.out.WriteString(`"` + word + `"`)
+		r.repaired(RepairUnquotedKey)
+	case word == "True":
+		r.out.WriteString("true")
+		r.repaired(RepairPythonLiteral)
+	case word == "False":
+		r.out.WriteString("false")
+		r.repaired(RepairPythonLiteral)
+	case word == "None":
+		r.out.WriteString("null")
+		r.repaired(RepairPythonLiteral)
+	default:
+		r.out.WriteString(word)
+	}
+	return end
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
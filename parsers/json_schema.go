@@ -0,0 +1,304 @@
+package parsers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/invopop/jsonschema"
+)
+
+// reflectSchema creates the json schema for the type of obj, in the same way models do for structured output.
+func reflectSchema(obj any) *jsonschema.Schema {
+	r := &jsonschema.Reflector{
+		BaseSchemaID:   "Anonymous",
+		Anonymous:      true,
+		DoNotReference: true,
+	}
+	return r.Reflect(obj)
+}
+
+// schemaViolations checks a value decoded from json (with numbers as json.Number) against the schema,
+// returning every violation found, phrased so that they can be passed back to an LLM as feedback.
+func schemaViolations(value any, schema *jsonschema.Schema) []error {
+	v := &schemaValidator{}
+	v.validate(value, schema, "", false)
+	return v.violations
+}
+
+type schemaValidator struct {
+	violations []error
+}
+
+func (v *schemaValidator) fail(path string, format string, args ...any) {
+	where := "at the top level"
+	if path != "" {
+		where = fmt.Sprintf("at '%s'", path)
+	}
+	v.violations = append(v.violations, fmt.Errorf("%s: %s", where, fmt.Sprintf(format, args...)))
+}
+
+// validate checks value against the schema. If optional is true, a null value is allowed regardless of the schema type.
+func (v *schemaValidator) validate(value any, schema *jsonschema.Schema, path string, optional bool) {
+	if schema == nil || schema == jsonschema.TrueSchema {
+		return
+	}
+	if schema == jsonschema.FalseSchema {
+		v.fail(path, "no value is allowed here")
+		return
+	}
+	if value == nil && optional {
+		return
+	}
+	if schema.Type != "" && !schemaTypeMatches(schema.Type, value) {
+		v.fail(path, "expected %s but got %s", withArticle(schema.Type), describeJsonValue(value))
+		return
+	}
+	if len(schema.Enum) > 0 && !slices.ContainsFunc(schema.Enum, func(e any) bool { return jsonEqual(e, value) }) {
+		v.fail(path, "%s is not one of the allowed values %s", describeJsonValue(value), jsonList(schema.Enum))
+	}
+	if schema.Const != nil && !jsonEqual(schema.Const, value) {
+		v.fail(path, "%s must be exactly %s", describeJsonValue(value), jsonString(schema.Const))
+	}
+	for _, sub := range schema.AllOf {
+		v.validate(value, sub, path, optional)
+	}
+	if len(schema.AnyOf) > 0 && !v.matchesAny(value, schema.AnyOf, path) {
+		v.fail(path, "%s does not match any of the allowed forms", describeJsonValue(value))
+	}
+	if len(schema.OneOf) > 0 && !v.matchesAny(value, schema.OneOf, path) {
+		v.fail(path, "%s does not match any of the allowed forms", describeJsonValue(value))
+	}
+	switch value := value.(type) {
+	case map[string]any:
+		v.validateObject(value, schema, path)
+	case []any:
+		v.validateArray(value, schema, path)
+	case string:
+		v.validateString(value, schema, path)
+	case json.Number:
+		v.validateNumber(value, schema, path)
+	}
+}
+
+func (v *schemaValidator) matchesAny(value any, schemas []*jsonschema.Schema, path string) bool {
+	for _, sub := range schemas {
+		if len(schemaViolations(value, sub)) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *schemaValidator) validateObject(value map[string]any, schema *jsonschema.Schema, path string) {
+	for _, req := range schema.Required {
+		if _, ok := value[req]; !ok {
+			v.fail(path, "missing required field '%s'", req)
+		}
+	}
+	keys := make([]string, 0, len(value))
+	for k := range value {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		childPath := k
+		if path != "" {
+			childPath = path + "." + k
+		}
+		if schema.Properties != nil {
+			if propSchema, ok := schema.Properties.Get(k); ok {
+				v.validate(value[k], propSchema, childPath, !slices.Contains(schema.Required, k))
+				continue
+			}
+		}
+		if schema.AdditionalProperties == jsonschema.FalseSchema {
+			v.fail(path, "unknown field '%s'%s", k, allowedFields(schema))
+			continue
+		}
+		v.validate(value[k], schema.AdditionalProperties, childPath, false)
+	}
+	if schema.MinProperties != nil && uint64(len(value)) < *schema.MinProperties {
+		v.fail(path, "expected at least %d fields but got %d", *schema.MinProperties, len(value))
+	}
+	if schema.MaxProperties != nil && uint64(len(value)) > *schema.MaxProperties {
+		v.fail(path, "expected at most %d fields but got %d", *schema.MaxProperties, len(value))
+	}
+}
+
+func (v *schemaValidator) validateArray(value []any, schema *jsonschema.Schema, path string) {
+	if schema.MinItems != nil && uint64(len(value)) < *schema.MinItems {
+		v.fail(path, "expected at least %d items but got %d", *schema.MinItems, len(value))
+	}
+	if schema.MaxItems != nil && uint64(len(value)) > *schema.MaxItems {
+		v.fail(path, "expected at most %d items but got %d", *schema.MaxItems, len(value))
+	}
+	if schema.UniqueItems {
+		for i := range value {
+			for j := range i {
+				if jsonEqual(value[i], value[j]) {
+					v.fail(path, "items %d and %d are duplicates, but items must be unique", j, i)
+				}
+			}
+		}
+	}
+	for i, item := range value {
+		v.validate(item, schema.Items, fmt.Sprintf("%s[%d]", path, i), false)
+	}
+}
+
+func (v *schemaValidator) validateString(value string, schema *jsonschema.Schema, path string) {
+	length := uint64(utf8.RuneCountInString(value))
+	if schema.MinLength != nil && length < *schema.MinLength {
+		v.fail(path, "expected a string of at least %d characters but got %d", *schema.MinLength, length)
+	}
+	if schema.MaxLength != nil && length > *schema.MaxLength {
+		v.fail(path, "expected a string of at most %d characters but got %d", *schema.MaxLength, length)
+	}
+	if schema.Pattern != "" {
+		re, err := regexp.Compile(schema.Pattern)
+		if err == nil && !re.MatchString(value) {
+			v.fail(path, "%s does not match the pattern %s", describeJsonValue(value), schema.Pattern)
+		}
+	}
+}
+
+func (v *schemaValidator) validateNumber(value json.Number, schema *jsonschema.Schema, path string) {
+	n, ok := new(big.Float).SetString(string(value))
+	if !ok {
+		return
+	}
+	cmp := func(limit json.Number) (int, bool) {
+		if limit == "" {
+			return 0, false
+		}
+		l, ok := new(big.Float).SetString(string(limit))
+		if !ok {
+			return 0, false
+		}
+		return n.Cmp(l), true
+	}
+	if c, ok := cmp(schema.Minimum); ok && c < 0 {
+		v.fail(path, "%s is less than the minimum of %s", value, schema.Minimum)
+	}
+	if c, ok := cmp(schema.Maximum); ok && c > 0 {
+		v.fail(path, "%s is more than the maximum of %s", value, schema.Maximum)
+	}
+	if c, ok := cmp(schema.ExclusiveMinimum); ok && c <= 0 {
+		v.fail(path, "%s must be more than %s", value, schema.ExclusiveMinimum)
+	}
+	if c, ok := cmp(schema.ExclusiveMaximum); ok && c >= 0 {
+		v.fail(path, "%s must be less than %s", value, schema.ExclusiveMaximum)
+	}
+	if schema.MultipleOf != "" {
+		f, _ := n.Float64()
+		m, err := schema.MultipleOf.Float64()
+		if err == nil && m != 0 {
+			q := f / m
+			if math.Abs(q-math.Round(q)) > 1e-9 {
+				v.fail(path, "%s is not a multiple of %s", value, schema.MultipleOf)
+			}
+		}
+	}
+}
+
+func schemaTypeMatches(typ string, value any) bool {
+	switch typ {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		f, ok := new(big.Float).SetString(string(n))
+		return ok && f.IsInt()
+	default:
+		return true
+	}
+}
+
+func withArticle(typ string) string {
+	switch typ {
+	case "object", "array", "integer":
+		return "an " + typ
+	default:
+		return "a " + typ
+	}
+}
+
+func describeJsonValue(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "an object"
+	case []any:
+		return "an array"
+	case string:
+		return fmt.Sprintf("the string %q", value)
+	case bool:
+		return fmt.Sprintf("the boolean %v", value)
+	case json.Number:
+		return fmt.Sprintf("the number %s", value)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+func allowedFields(schema *jsonschema.Schema) string {
+	if schema.Properties == nil || schema.Properties.Len() == 0 {
+		return " (no fields are allowed)"
+	}
+	names := []string{}
+	for pair := schema.Properties.Oldest(); pair != nil; pair = pair.Next() {
+		names = append(names, "'"+pair.Key+"'")
+	}
+	return " (allowed fields are " + strings.Join(names, ", ") + ")"
+}
+
+// jsonEqual compares two values by their canonical json encodings, so that numbers of different go types compare equal.
+func jsonEqual(a, b any) bool {
+	return jsonString(a) == jsonString(b)
+}
+
+func jsonString(v any) string {
+	if n, ok := v.(json.Number); ok {
+		if f, err := n.Float64(); err == nil {
+			v = f
+		}
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+func jsonList(vs []any) string {
+	ss := make([]string, len(vs))
+	for i, v := range vs {
+		ss[i] = jsonString(v)
+	}
+	return "[" + strings.Join(ss, ", ") + "]"
+}
@@ -0,0 +1,309 @@
+package parsers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/internal/utils"
+)
+
+// StreamingParser is a [jpf.Parser] that can also consume a response as it is streamed from a model.
+type StreamingParser[T any] interface {
+	jpf.Parser[T]
+	jpf.ModelStreamer
+}
+
+// NewStreamingJson creates a [StreamingParser] that incrementally parses a json value as the response is streamed.
+// Each time a streamed fragment changes the partially parsed value, onPartial is called with a progressively filled T.
+// Incomplete tokens are tolerated: unfinished strings are included up to the last complete character,
+// while unfinished numbers, literals and keys are left out until they are complete.
+// T must be a struct, a map with string keys, a slice, or a pointer to one of these.
+// Once the response is complete, ParseResponseText parses the first complete json value of the right kind.
+// Pass the parser to a pipeline both as the parser and with [pipelines.WithStreamer] to receive partial results.
+// The parser holds the state of a single response, so if the pipeline may be called concurrently,
+// use [pipelines.WithStreamerFactory] to create a new parser to stream each call to instead.
+func NewStreamingJson[T any](onPartial func(T)) StreamingParser[T] {
+	return &streamingJsonParser[T]{
+		opener:    jsonOpenerFor[T]("NewStreamingJson"),
+		onPartial: onPartial,
+	}
+}
+
+type streamingJsonParser[T any] struct {
+	opener    byte
+	onPartial func(T)
+	lock      sync.Mutex
+	text      strings.Builder
+	last      []byte
+}
+
+// OnMessageBegin implements jpf.ModelStreamer.
+func (p *streamingJsonParser[T]) OnMessageBegin() {
+	p.reset()
+}
+
+// OnMessageReset implements jpf.ModelStreamer.
+func (p *streamingJsonParser[T]) OnMessageReset() {
+	p.reset()
+}
+
+// OnMessageText implements jpf.ModelStreamer.
+func (p *streamingJsonParser[T]) OnMessageText(text string) {
+	p.lock.Lock()
+	p.text.WriteString(text)
+	completed, ok := completePartialJson(p.text.String(), p.opener)
+	if !ok {
+		p.lock.Unlock()
+		return
+	}
+	var partial T
+	if err := json.Unmarshal([]byte(completed), &partial); err != nil {
+		p.lock.Unlock()
+		return
+	}
+	canonical, err := json.Marshal(partial)
+	if err != nil || bytes.Equal(canonical, p.last) {
+		p.lock.Unlock()
+		return
+	}
+	p.last = canonical
+	p.lock.Unlock()
+	if p.onPartial != nil {
+		p.onPartial(partial)
+	}
+}
+
+func (p *streamingJsonParser[T]) reset() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.text.Reset()
+	p.last = nil
+}
+
+// ParseResponseText implements jpf.Parser.
+func (p *streamingJsonParser[T]) ParseResponseText(response string) (T, error) {
+	var result T
+	match, ok := firstCompleteJson(response, p.opener)
+	if !ok {
+		return result, utils.Wrap(jpf.ErrInvalidResponse, "response did not contain a complete json value")
+	}
+	if err := json.Unmarshal([]byte(match), &result); err != nil {
+		var zero T
+		return zero, utils.Wrap(errors.Join(err, jpf.ErrInvalidResponse), "llm returned an invalid json value")
+	}
+	return result, nil
+}
+
+// jsonOpenerFor finds the opening bracket of the top level json value that T decodes from, panicking if T is unsupported.
+func jsonOpenerFor[T any](constructor string) byte {
+	typ := jsonTargetType[T]()
+	switch {
+	case typ.Kind() == reflect.Struct, typ.Kind() == reflect.Map && typ.Key().Kind() == reflect.String:
+		return '{'
+	case typ.Kind() == reflect.Slice, typ.Kind() == reflect.Array:
+		return '['
+	default:
+		panic(constructor + ": T must be a struct, a map with string keys, a slice, or a pointer to one of these")
+	}
+}
+
+// jsonScanState is the grammar position within a container.
+type jsonScanState uint8
+
+const (
+	expectKey jsonScanState = iota
+	expectColon
+	expectValue
+	expectCommaOrEnd
+)
+
+type jsonScanFrame struct {
+	closer byte
+	state  jsonScanState
+}
+
+// jsonScanner walks a possibly incomplete json value one byte at a time,
+// remembering the last position at which the value could be cut and closed to form valid json.
+type jsonScanner struct {
+	src   string
+	stack []jsonScanFrame
+	// The end of the longest prefix that is valid once safeClosers is appended.
+	safe        int
+	safeClosers string
+	// Set once the top level value has been closed.
+	complete int
+}
+
+func closersOf(stack []jsonScanFrame) string {
+	b := make([]byte, len(stack))
+	for i := range stack {
+		b[len(stack)-1-i] = stack[i].closer
+	}
+	return string(b)
+}
+
+func (s *jsonScanner) markSafe(pos int) {
+	s.safe = pos
+	s.safeClosers = closersOf(s.stack)
+}
+
+// valueDone advances the state of the enclosing container after a value (or key) ending at pos.
+func (s *jsonScanner) valueDone(pos int) {
+	if len(s.stack) == 0 {
+		s.complete = pos
+		return
+	}
+	top := &s.stack[len(s.stack)-1]
+	if top.closer == '}' && top.state == expectKey {
+		top.state = expectColon
+		return
+	}
+	top.state = expectCommaOrEnd
+	s.markSafe(pos)
+}
+
+// scan walks the value starting at start (which must be an opening bracket).
+// If the input ended inside a string value, it returns the position of the opening quote so that the string can be closed and included.
+// Otherwise, it returns -1.
+func (s *jsonScanner) scan(start int) int {
+	i := start
+	for i < len(s.src) && s.complete == 0 {
+		c := s.src[i]
+		switch {
+		case c == '{' || c == '[':
+			closer := byte('}')
+			state := expectKey
+			if c == '[' {
+				closer = ']'
+				state = expectValue
+			}
+			s.stack = append(s.stack, jsonScanFrame{closer, state})
+			s.markSafe(i + 1)
+			i++
+		case c == '}' || c == ']':
+			if len(s.stack) == 0 || s.stack[len(s.stack)-1].closer != c {
+				return -1
+			}
+			s.stack = s.stack[:len(s.stack)-1]
+			i++
+			s.valueDone(i)
+		case c == '"':
+			isValue := len(s.stack) > 0 && s.stack[len(s.stack)-1].state != expectKey
+			end := i + 1
+			for end < len(s.src) && s.src[end] != '"' {
+				if s.src[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s.src) {
+				if isValue {
+					return i
+				}
+				return -1
+			}
+			i = end + 1
+			s.valueDone(i)
+		case c == ',':
+			if len(s.stack) > 0 {
+				top := &s.stack[len(s.stack)-1]
+				if top.closer == '}' {
+					top.state = expectKey
+				} else {
+					top.state = expectValue
+				}
+			}
+			i++
+		case c == ':':
+			if len(s.stack) > 0 {
+				s.stack[len(s.stack)-1].state = expectValue
+			}
+			i++
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		default:
+			// A number or literal - it is only safe once something follows it, as otherwise it may be cut short.
+			end := i
+			for end < len(s.src) && !strings.ContainsRune(",:]}\" \t\n\r", rune(s.src[end])) {
+				end++
+			}
+			if end >= len(s.src) {
+				return -1
+			}
+			if !json.Valid([]byte(s.src[i:end])) {
+				return -1
+			}
+			i = end
+			s.valueDone(i)
+		}
+	}
+	return -1
+}
+
+// completePartialJson finds the first json value opened by the given bracket, and closes any unfinished parts of it,
+// returning valid json representing everything that has been completely received so far.
+func completePartialJson(text string, opener byte) (string, bool) {
+	start := strings.IndexByte(text, opener)
+	if start == -1 {
+		return "", false
+	}
+	s := &jsonScanner{src: text}
+	openString := s.scan(start)
+	if s.complete != 0 {
+		return text[start:s.complete], true
+	}
+	if openString != -1 {
+		partial := trimIncompleteEscape(text[openString+1:])
+		return text[start:openString] + `"` + partial + `"` + closersOf(s.stack), true
+	}
+	if s.safe == 0 {
+		return "", false
+	}
+	return text[start:s.safe] + s.safeClosers, true
+}
+
+// firstCompleteJson finds the first complete, balanced json value opened by the given bracket.
+func firstCompleteJson(text string, opener byte) (string, bool) {
+	for offset := 0; offset < len(text); {
+		start := strings.IndexByte(text[offset:], opener)
+		if start == -1 {
+			return "", false
+		}
+		start += offset
+		s := &jsonScanner{src: text}
+		s.scan(start)
+		if s.complete != 0 {
+			return text[start:s.complete], true
+		}
+		offset = start + 1
+	}
+	return "", false
+}
+
+// trimIncompleteEscape removes a trailing partial escape sequence from the contents of an unfinished string.
+func trimIncompleteEscape(s string) string {
+	for i := len(s) - 1; i >= 0 && i >= len(s)-6; i-- {
+		if s[i] != '\\' {
+			continue
+		}
+		// Count the backslashes, as an escaped backslash is complete.
+		n := 0
+		for j := i; j >= 0 && s[j] == '\\'; j-- {
+			n++
+		}
+		if n%2 == 0 {
+			return s
+		}
+		seq := s[i:]
+		if len(seq) == 1 || (seq[1] == 'u' && len(seq) < 6) {
+			return s[:i]
+		}
+		return s
+	}
+	return s
+}
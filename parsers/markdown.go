@@ -0,0 +1,226 @@
+package parsers
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/internal/utils"
+)
+
+// NewCodeBlock creates a [Parser] that returns the contents of a fenced code block from a markdown response.
+// Index selects which block to use, starting at 0, and negative indices count back from the last block (so -1 is the last block).
+// If any languages are given, only blocks whose language (the first word of the info string) is one of them (case-insensitive) are considered.
+func NewCodeBlock(index int, languages ...string) jpf.Parser[string] {
+	return &codeBlockParser{
+		index:     index,
+		languages: lowerAll(languages),
+	}
+}
+
+// NewCodeBlocks creates a [Parser] that returns the contents of every fenced code block in a markdown response.
+// If any languages are given, only blocks whose language (the first word of the info string) is one of them (case-insensitive) are returned.
+// At least one block must be present.
+func NewCodeBlocks(languages ...string) jpf.Parser[[]string] {
+	return &codeBlocksParser{
+		languages: lowerAll(languages),
+	}
+}
+
+type codeBlockParser struct {
+	index     int
+	languages []string
+}
+
+func (p *codeBlockParser) ParseResponseText(response string) (string, error) {
+	blocks, err := matchingCodeBlocks(response, p.languages)
+	if err != nil {
+		return "", err
+	}
+	i := p.index
+	if i < 0 {
+		i += len(blocks)
+	}
+	if i < 0 || i >= len(blocks) {
+		return "", utils.Wrap(jpf.ErrInvalidResponse, "response contained %d %s but block %d was required", len(blocks), describeCodeBlocks(p.languages), p.index)
+	}
+	return blocks[i], nil
+}
+
+type codeBlocksParser struct {
+	languages []string
+}
+
+func (p *codeBlocksParser) ParseResponseText(response string) ([]string, error) {
+	return matchingCodeBlocks(response, p.languages)
+}
+
+// matchingCodeBlocks returns the code of the blocks with one of the languages (or all blocks if there are no languages), requiring at least one.
+func matchingCodeBlocks(response string, languages []string) ([]string, error) {
+	blocks, unclosed := markdownCodeBlocks(response)
+	codes := []string{}
+	for _, b := range blocks {
+		if len(languages) == 0 || slices.Contains(languages, b.language) {
+			codes = append(codes, b.code)
+		}
+	}
+	if len(codes) == 0 {
+		if unclosed {
+			return nil, utils.Wrap(jpf.ErrInvalidResponse, "response did not contain any complete %s (a code block was not closed)", describeCodeBlocks(languages))
+		}
+		return nil, utils.Wrap(jpf.ErrInvalidResponse, "response did not contain any %s", describeCodeBlocks(languages))
+	}
+	return codes, nil
+}
+
+func describeCodeBlocks(languages []string) string {
+	if len(languages) == 0 {
+		return "fenced code blocks"
+	}
+	return strings.Join(languages, " or ") + " fenced code blocks"
+}
+
+func lowerAll(ss []string) []string {
+	lowered := make([]string, len(ss))
+	for i, s := range ss {
+		lowered[i] = strings.ToLower(s)
+	}
+	return lowered
+}
+
+// NewMarkdownTable creates a [Parser] that reads the first markdown table in the response into a slice of structs, one per row.
+// Columns are mapped to fields by header name (case-insensitive), using the table struct tag if present (for example `table:"Unit Price"`), or the field name otherwise.
+// A column is required for every field unless the tag includes optional (for example `table:"Notes,optional"`), and extra columns are ignored.
+// Fields may be strings, numbers, bools, times, durations or types implementing [encoding.TextUnmarshaler], or pointers to these (where an empty cell leaves the pointer nil).
+// Missing columns and conversion errors are all returned together, joined with [jpf.ErrInvalidResponse].
+// T must be a struct, and NewMarkdownTable panics if any mapped field has an unsupported type.
+func NewMarkdownTable[T any]() jpf.Parser[[]T] {
+	typ := reflect.TypeFor[T]()
+	if typ.Kind() != reflect.Struct {
+		panic("NewMarkdownTable: T must be a struct")
+	}
+	p := &markdownTableParser[T]{}
+	for i := range typ.NumField() {
+		f := typ.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("table")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		if !canSetFromText(f.Type) {
+			panic(fmt.Sprintf("NewMarkdownTable: field %s has unsupported type %s", f.Name, f.Type))
+		}
+		p.columns = append(p.columns, tableColumn{index: i, header: name, optional: options == "optional"})
+	}
+	return p
+}
+
+type markdownTableParser[T any] struct {
+	columns []tableColumn
+}
+
+type tableColumn struct {
+	index    int
+	header   string
+	optional bool
+}
+
+var tableDelimiterPattern = regexp.MustCompile(`^\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?$`)
+
+func (p *markdownTableParser[T]) ParseResponseText(response string) ([]T, error) {
+	headers, rows, ok := firstMarkdownTable(response)
+	if !ok {
+		return nil, utils.Wrap(jpf.ErrInvalidResponse, "response did not contain a markdown table")
+	}
+	errs := []error{}
+	cells := make([]int, len(p.columns))
+	for i, col := range p.columns {
+		cells[i] = slices.IndexFunc(headers, func(h string) bool { return normaliseHeader(h) == normaliseHeader(col.header) })
+		if cells[i] == -1 && !col.optional {
+			errs = append(errs, fmt.Errorf("missing required column '%s'", col.header))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, utils.Wrap(errors.Join(append(errs, jpf.ErrInvalidResponse)...), "llm returned a markdown table without the expected columns")
+	}
+	results := make([]T, len(rows))
+	for r, row := range rows {
+		v := reflect.ValueOf(&results[r]).Elem()
+		for i, col := range p.columns {
+			if cells[i] == -1 || cells[i] >= len(row) {
+				continue
+			}
+			cell := row[cells[i]]
+			fv := v.Field(col.index)
+			if fv.Kind() == reflect.Pointer && strings.TrimSpace(cell) == "" {
+				continue
+			}
+			if err := setFromText(fv, cell); err != nil {
+				errs = append(errs, fmt.Errorf("row %d, column '%s': %w", r+1, col.header, err))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, utils.Wrap(errors.Join(append(errs, jpf.ErrInvalidResponse)...), "llm returned a markdown table with invalid values")
+	}
+	return results, nil
+}
+
+// firstMarkdownTable finds the first github style markdown table in the text, returning its header and body cells.
+func firstMarkdownTable(text string) ([]string, [][]string, bool) {
+	lines := strings.Split(text, "\n")
+	for i := 0; i+1 < len(lines); i++ {
+		header := strings.TrimSpace(lines[i])
+		if !strings.Contains(header, "|") || !tableDelimiterPattern.MatchString(strings.TrimSpace(lines[i+1])) {
+			continue
+		}
+		headers := splitTableRow(header)
+		rows := [][]string{}
+		for _, line := range lines[i+2:] {
+			line = strings.TrimSpace(line)
+			if line == "" || !strings.Contains(line, "|") {
+				break
+			}
+			rows = append(rows, splitTableRow(line))
+		}
+		return headers, rows, true
+	}
+	return nil, nil, false
+}
+
+// splitTableRow splits a table row into its trimmed cells, respecting escaped pipes.
+func splitTableRow(line string) []string {
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	cells := []string{}
+	cell := &strings.Builder{}
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+func normaliseHeader(h string) string {
+	return strings.ToLower(strings.Join(strings.Fields(h), " "))
+}
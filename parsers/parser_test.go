@@ -3,7 +3,10 @@ package parsers
 import (
 	"errors"
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/JoshPattman/jpf"
 	"github.com/JoshPattman/jpf/internal/utils"
@@ -21,6 +24,91 @@ func buildTestingSubstringAfterRespDec() jpf.Parser[string] {
 	return SubstringAfter(NewRaw(), ">>>")
 }
 
+func buildTestingRepairingJson() jpf.Parser[utils.TestStruct] {
+	return NewRepairingJson[utils.TestStruct]()
+}
+
+func buildTestingStrictRepairingJson() jpf.Parser[utils.TestStruct] {
+	return NewRepairingJson[utils.TestStruct](WithRepairsAsErrors())
+}
+
+type schemaTestStruct struct {
+	Label string  `json:"label" jsonschema:"enum=positive,enum=negative"`
+	Score float64 `json:"score" jsonschema:"minimum=0,maximum=1"`
+	Code  string  `json:"code,omitempty" jsonschema:"pattern=^[A-Z]{3}$"`
+}
+
+type xmlTestStruct struct {
+	XMLName struct{} `xml:"result"`
+	A       int      `xml:"a"`
+	B       string   `xml:"b,attr"`
+}
+
+type sectionsTestStruct struct {
+	Reasoning  string  `section:"reasoning,optional"`
+	Answer     string  `section:"answer"`
+	Confidence float64 `section:"confidence,optional"`
+}
+
+func buildTestingLastGoCodeBlock() jpf.Parser[string] {
+	return NewCodeBlock(-1, "go")
+}
+
+func buildTestingFirstCodeBlock() jpf.Parser[string] {
+	return NewCodeBlock(0)
+}
+
+const testingMarkdownResponse = "Here is the plan:\n```bash\ngo test ./...\n```\nAnd the code:\n````Go title=main.go\nfunc a() {}\n```\n````\nor\n~~~go\nfunc b() {}\n~~~\n"
+
+type regexTestStruct struct {
+	Label string  `regex:"label,enum=Positive|Negative"`
+	Score float64 `regex:"score"`
+	Sure  bool
+}
+
+const testingRegexPattern = `LABEL:\s*(?P<label>\w+)\s*\((?P<score>[^)]*)\)(?:\s*SURE:\s*(?P<sure>\w+))?`
+
+func buildTestingRegex() jpf.Parser[regexTestStruct] {
+	return NewRegex[regexTestStruct](testingRegexPattern)
+}
+
+func buildTestingLastRegex() jpf.Parser[regexTestStruct] {
+	return NewRegex[regexTestStruct](testingRegexPattern, WithLastMatch())
+}
+
+type sentiment string
+
+const (
+	positive     sentiment = "positive"
+	veryPositive sentiment = "very positive"
+	negative     sentiment = "negative"
+)
+
+func buildTestingChoice() jpf.Parser[sentiment] {
+	return NewChoice(
+		[]sentiment{positive, veryPositive, negative},
+		WithAlias("negative", "bad"),
+		WithMaxEditDistance(2),
+	)
+}
+
+func buildTestingJsonOrYAML() jpf.Parser[utils.TestStruct] {
+	return OneOf(NewJson[utils.TestStruct](), NewYAML[utils.TestStruct]())
+}
+
+func buildTestingMappedInt() jpf.Parser[string] {
+	return Map(NewJson[int](), func(n int) (string, error) {
+		if n < 0 {
+			return "", errors.Join(errors.New("the number must not be negative"), jpf.ErrInvalidResponse)
+		}
+		return strings.Repeat("x", n), nil
+	})
+}
+
+func buildTestingDefaultInt() jpf.Parser[int] {
+	return WithDefault(NewJson[int](), -1)
+}
+
 type RDCase[T comparable] struct {
 	ID            string
 	Build         func() jpf.Parser[T]
@@ -74,6 +162,366 @@ var RDCases = []utils.TestCase{
 		Input:    "Here is my answer:\n```" + `{"a":5, "b": "xyz"}` + "```",
 		Expected: utils.TestStruct{A: 5, B: "xyz"},
 	},
+	RDCase[utils.TestStruct]{
+		ID:       "json/unknown_field_without_schema",
+		Build:    NewJson[utils.TestStruct],
+		Input:    `{"a":5, "c": 1}`,
+		Expected: utils.TestStruct{A: 5},
+	},
+	RDCase[utils.TestStruct]{
+		ID:       "json/first_of_several_objects",
+		Build:    NewJson[utils.TestStruct],
+		Input:    `First {"a": 1, "b": "}"} then {"a": 2}`,
+		Expected: utils.TestStruct{A: 1, B: "}"},
+	},
+	RDCase[int]{
+		ID:       "json/int",
+		Build:    NewJson[int],
+		Input:    "The answer is 42.",
+		Expected: 42,
+	},
+	RDCase[int]{
+		ID:       "json/int_skips_words",
+		Build:    NewJson[int],
+		Input:    "Using gpt4, the answer is -7",
+		Expected: -7,
+	},
+	RDCase[int]{
+		ID:            "json/int_from_float",
+		Build:         NewJson[int],
+		Input:         "3.5",
+		ExpectedError: true,
+	},
+	RDCase[float64]{
+		ID:       "json/float",
+		Build:    NewJson[float64],
+		Input:    "score: 0.75",
+		Expected: 0.75,
+	},
+	RDCase[bool]{
+		ID:       "json/bool",
+		Build:    NewJson[bool],
+		Input:    "```json\nfalse\n```",
+		Expected: false,
+	},
+	RDCase[bool]{
+		ID:            "json/no_bool",
+		Build:         NewJson[bool],
+		Input:         "trueish",
+		ExpectedError: true,
+	},
+	RDCase[string]{
+		ID:       "json/string",
+		Build:    NewJson[string],
+		Input:    `He said "a \"quoted\" word"`,
+		Expected: `a "quoted" word`,
+	},
+	RDCase[schemaTestStruct]{
+		ID:       "jsonschema/valid",
+		Build:    NewValidatedJson[schemaTestStruct],
+		Input:    `{"label": "positive", "score": 0.9}`,
+		Expected: schemaTestStruct{Label: "positive", Score: 0.9},
+	},
+	RDCase[schemaTestStruct]{
+		ID:            "jsonschema/missing_required",
+		Build:         NewValidatedJson[schemaTestStruct],
+		Input:         `{"label": "positive"}`,
+		ExpectedError: true,
+	},
+	RDCase[schemaTestStruct]{
+		ID:            "jsonschema/unknown_field",
+		Build:         NewValidatedJson[schemaTestStruct],
+		Input:         `{"label": "positive", "score": 0.9, "extra": true}`,
+		ExpectedError: true,
+	},
+	RDCase[schemaTestStruct]{
+		ID:            "jsonschema/enum",
+		Build:         NewValidatedJson[schemaTestStruct],
+		Input:         `{"label": "Positive", "score": 0.9}`,
+		ExpectedError: true,
+	},
+	RDCase[schemaTestStruct]{
+		ID:            "jsonschema/maximum",
+		Build:         NewValidatedJson[schemaTestStruct],
+		Input:         `{"label": "positive", "score": 1.5}`,
+		ExpectedError: true,
+	},
+	RDCase[schemaTestStruct]{
+		ID:            "jsonschema/pattern",
+		Build:         NewValidatedJson[schemaTestStruct],
+		Input:         `{"label": "positive", "score": 0.5, "code": "abc"}`,
+		ExpectedError: true,
+	},
+	RDCase[schemaTestStruct]{
+		ID:            "jsonschema/wrong_type",
+		Build:         NewValidatedJson[schemaTestStruct],
+		Input:         `{"label": "positive", "score": "high"}`,
+		ExpectedError: true,
+	},
+	RDCase[utils.TestStruct]{
+		ID:       "jsonrepair/valid_json",
+		Build:    buildTestingRepairingJson,
+		Input:    `Answer: {"a": 5, "b": "xyz"} done {"a": 6}`,
+		Expected: utils.TestStruct{A: 5, B: "xyz"},
+	},
+	RDCase[utils.TestStruct]{
+		ID:       "jsonrepair/sloppy_json",
+		Build:    buildTestingRepairingJson,
+		Input:    "{a: 5, // the count\n 'b': 'it\\'s\nfine',}",
+		Expected: utils.TestStruct{A: 5, B: "it's\nfine"},
+	},
+	RDCase[utils.TestStruct]{
+		ID:       "jsonrepair/truncated_json",
+		Build:    buildTestingRepairingJson,
+		Input:    `{"a": 5, "b": "xy`,
+		Expected: utils.TestStruct{A: 5, B: "xy"},
+	},
+	RDCase[utils.TestStruct]{
+		ID:            "jsonrepair/mismatched_brackets",
+		Build:         buildTestingRepairingJson,
+		Input:         `{"a": 5]`,
+		ExpectedError: true,
+	},
+	RDCase[utils.TestStruct]{
+		ID:       "jsonrepair/strict_valid_json",
+		Build:    buildTestingStrictRepairingJson,
+		Input:    `{"a": 5, "b": "xyz"}`,
+		Expected: utils.TestStruct{A: 5, B: "xyz"},
+	},
+	RDCase[utils.TestStruct]{
+		ID:            "jsonrepair/strict_trailing_comma",
+		Build:         buildTestingStrictRepairingJson,
+		Input:         `{"a": 5, "b": "xyz",}`,
+		ExpectedError: true,
+	},
+	RDCase[utils.TestStruct]{
+		ID:       "yaml/plain",
+		Build:    NewYAML[utils.TestStruct],
+		Input:    "a: 5\nb: xyz\n",
+		Expected: utils.TestStruct{A: 5, B: "xyz"},
+	},
+	RDCase[utils.TestStruct]{
+		ID:       "yaml/fenced",
+		Build:    NewYAML[utils.TestStruct],
+		Input:    "Sure:\n```python\nprint(1)\n```\n```yaml\na: 5\nb: |\n  multi\n  line\n```\nDone.",
+		Expected: utils.TestStruct{A: 5, B: "multi\nline\n"},
+	},
+	RDCase[utils.TestStruct]{
+		ID:            "yaml/invalid",
+		Build:         NewYAML[utils.TestStruct],
+		Input:         "```yaml\na: [1\n```",
+		ExpectedError: true,
+	},
+	RDCase[utils.TestStruct]{
+		ID:            "yaml/empty",
+		Build:         NewYAML[utils.TestStruct],
+		Input:         "",
+		ExpectedError: true,
+	},
+	RDCase[xmlTestStruct]{
+		ID:       "xml/decorated",
+		Build:    NewXML[xmlTestStruct],
+		Input:    `Here: <result b="xyz"><a>5</a></result> hope that helps`,
+		Expected: xmlTestStruct{A: 5, B: "xyz"},
+	},
+	RDCase[xmlTestStruct]{
+		ID:       "xml/fenced",
+		Build:    NewXML[xmlTestStruct],
+		Input:    "```xml\n<result b=\"xyz\">\n  <a>5</a>\n</result>\n```",
+		Expected: xmlTestStruct{A: 5, B: "xyz"},
+	},
+	RDCase[xmlTestStruct]{
+		ID:            "xml/wrong_root",
+		Build:         NewXML[xmlTestStruct],
+		Input:         `<answer><a>5</a></answer>`,
+		ExpectedError: true,
+	},
+	RDCase[xmlTestStruct]{
+		ID:            "xml/no_xml",
+		Build:         NewXML[xmlTestStruct],
+		Input:         `a is 5`,
+		ExpectedError: true,
+	},
+	RDCase[utils.TestStruct]{
+		ID:       "toml/fenced",
+		Build:    NewTOML[utils.TestStruct],
+		Input:    "```toml\na = 5\nb = \"xyz\"\n```",
+		Expected: utils.TestStruct{A: 5, B: "xyz"},
+	},
+	RDCase[utils.TestStruct]{
+		ID:            "toml/invalid",
+		Build:         NewTOML[utils.TestStruct],
+		Input:         "a = = 5",
+		ExpectedError: true,
+	},
+	RDCase[sectionsTestStruct]{
+		ID:       "sections/all",
+		Build:    NewSections[sectionsTestStruct],
+		Input:    "<reasoning>\nIt is < 5 & > 3.\n</reasoning>\nSo:\n<answer>4</answer> <confidence> 0.9 </confidence>",
+		Expected: sectionsTestStruct{Reasoning: "It is < 5 & > 3.", Answer: "4", Confidence: 0.9},
+	},
+	RDCase[sectionsTestStruct]{
+		ID:       "sections/optional_missing",
+		Build:    NewSections[sectionsTestStruct],
+		Input:    "<ANSWER>4</ANSWER>",
+		Expected: sectionsTestStruct{Answer: "4"},
+	},
+	RDCase[sectionsTestStruct]{
+		ID:            "sections/required_missing",
+		Build:         NewSections[sectionsTestStruct],
+		Input:         "<reasoning>hmm</reasoning>",
+		ExpectedError: true,
+	},
+	RDCase[sectionsTestStruct]{
+		ID:            "sections/unclosed",
+		Build:         NewSections[sectionsTestStruct],
+		Input:         "<answer>4",
+		ExpectedError: true,
+	},
+	RDCase[sectionsTestStruct]{
+		ID:            "sections/bad_number",
+		Build:         NewSections[sectionsTestStruct],
+		Input:         "<answer>4</answer><confidence>high</confidence>",
+		ExpectedError: true,
+	},
+	RDCase[string]{
+		ID:       "codeblock/first",
+		Build:    buildTestingFirstCodeBlock,
+		Input:    testingMarkdownResponse,
+		Expected: "go test ./...\n",
+	},
+	RDCase[string]{
+		ID:       "codeblock/last_by_language",
+		Build:    buildTestingLastGoCodeBlock,
+		Input:    testingMarkdownResponse,
+		Expected: "func b() {}\n",
+	},
+	RDCase[string]{
+		ID:            "codeblock/none",
+		Build:         buildTestingFirstCodeBlock,
+		Input:         "func a() {}",
+		ExpectedError: true,
+	},
+	RDCase[string]{
+		ID:            "codeblock/unclosed",
+		Build:         buildTestingLastGoCodeBlock,
+		Input:         "```go\nfunc a() {",
+		ExpectedError: true,
+	},
+	RDCase[regexTestStruct]{
+		ID:       "regex/first",
+		Build:    buildTestingRegex,
+		Input:    "Thinking... LABEL: positive (0.92) SURE: yes\nLABEL: negative (0.1)",
+		Expected: regexTestStruct{Label: "Positive", Score: 0.92, Sure: true},
+	},
+	RDCase[regexTestStruct]{
+		ID:       "regex/last",
+		Build:    buildTestingLastRegex,
+		Input:    "Thinking... LABEL: positive (0.92) SURE: yes\nLABEL: negative (0.1)",
+		Expected: regexTestStruct{Label: "Negative", Score: 0.1},
+	},
+	RDCase[regexTestStruct]{
+		ID:            "regex/no_match",
+		Build:         buildTestingRegex,
+		Input:         "It is positive",
+		ExpectedError: true,
+	},
+	RDCase[regexTestStruct]{
+		ID:            "regex/not_in_enum",
+		Build:         buildTestingRegex,
+		Input:         "LABEL: neutral (0.5)",
+		ExpectedError: true,
+	},
+	RDCase[regexTestStruct]{
+		ID:            "regex/bad_number",
+		Build:         buildTestingRegex,
+		Input:         "LABEL: positive (high)",
+		ExpectedError: true,
+	},
+	RDCase[sentiment]{
+		ID:       "choice/exact",
+		Build:    buildTestingChoice,
+		Input:    " Positive. ",
+		Expected: positive,
+	},
+	RDCase[sentiment]{
+		ID:       "choice/contained",
+		Build:    buildTestingChoice,
+		Input:    "The sentiment is positive overall",
+		Expected: positive,
+	},
+	RDCase[sentiment]{
+		ID:       "choice/longest_phrase",
+		Build:    buildTestingChoice,
+		Input:    "I would say VERY positive!",
+		Expected: veryPositive,
+	},
+	RDCase[sentiment]{
+		ID:       "choice/alias",
+		Build:    buildTestingChoice,
+		Input:    "bad",
+		Expected: negative,
+	},
+	RDCase[sentiment]{
+		ID:       "choice/misspelled",
+		Build:    buildTestingChoice,
+		Input:    "Label: negatve",
+		Expected: negative,
+	},
+	RDCase[sentiment]{
+		ID:            "choice/ambiguous",
+		Build:         buildTestingChoice,
+		Input:         "Either positive or negative",
+		ExpectedError: true,
+	},
+	RDCase[sentiment]{
+		ID:            "choice/no_match",
+		Build:         buildTestingChoice,
+		Input:         "neutral",
+		ExpectedError: true,
+	},
+	RDCase[utils.TestStruct]{
+		ID:       "oneof/first",
+		Build:    buildTestingJsonOrYAML,
+		Input:    `{"a": 1, "b": "x"}`,
+		Expected: utils.TestStruct{A: 1, B: "x"},
+	},
+	RDCase[utils.TestStruct]{
+		ID:       "oneof/second",
+		Build:    buildTestingJsonOrYAML,
+		Input:    "a: 1\nb: x",
+		Expected: utils.TestStruct{A: 1, B: "x"},
+	},
+	RDCase[utils.TestStruct]{
+		ID:            "oneof/none",
+		Build:         buildTestingJsonOrYAML,
+		Input:         "a: [",
+		ExpectedError: true,
+	},
+	RDCase[string]{
+		ID:       "map/valid",
+		Build:    buildTestingMappedInt,
+		Input:    "3",
+		Expected: "xxx",
+	},
+	RDCase[string]{
+		ID:            "map/transform_error",
+		Build:         buildTestingMappedInt,
+		Input:         "-3",
+		ExpectedError: true,
+	},
+	RDCase[int]{
+		ID:       "default/valid",
+		Build:    buildTestingDefaultInt,
+		Input:    "3",
+		Expected: 3,
+	},
+	RDCase[int]{
+		ID:       "default/invalid",
+		Build:    buildTestingDefaultInt,
+		Input:    "three",
+		Expected: -1,
+	},
 	RDCase[string]{
 		ID:       "string/empty_string",
 		Build:    NewRaw,
@@ -139,3 +587,422 @@ var RDCases = []utils.TestCase{
 func TestParser(t *testing.T) {
 	utils.RunTests(t, RDCases)
 }
+
+func TestJsonArraysAndPointers(t *testing.T) {
+	items, err := NewJson[[]utils.TestStruct]().ParseResponseText("Here you go:\n```json\n[{\"a\": 1}, {\"b\": \"]\"}]\n```\nAnd [1]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(items, []utils.TestStruct{{A: 1}, {B: "]"}}) {
+		t.Fatalf("unexpected items %v", items)
+	}
+
+	ptr, err := NewJson[*utils.TestStruct]().ParseResponseText(`{"a": 3}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ptr == nil || *ptr != (utils.TestStruct{A: 3}) {
+		t.Fatalf("unexpected pointer result %v", ptr)
+	}
+
+	if _, err := NewJson[[]int]().ParseResponseText(`{"a": 1}`); !errors.Is(err, jpf.ErrInvalidResponse) {
+		t.Fatalf("expected an invalid response when there is no array, got %v", err)
+	}
+}
+
+func TestFormatInstructions(t *testing.T) {
+	type example struct {
+		Name  string `yaml:"name" toml:"name"`
+		Count int    `yaml:"count" toml:"count"`
+	}
+	cases := []struct {
+		instructions string
+		expected     []string
+	}{
+		{YAMLInstructions[example](), []string{"```yaml", "name: \"\"", "count: 0"}},
+		{TOMLInstructions[example](), []string{"```toml", "name = \"\"", "count = 0"}},
+		{XMLInstructions[xmlTestStruct](), []string{"```xml", `<result b="">`, "<a>0</a>"}},
+	}
+	for _, c := range cases {
+		for _, expected := range c.expected {
+			if !strings.Contains(c.instructions, expected) {
+				t.Fatalf("expected instructions to contain %q, got:\n%s", expected, c.instructions)
+			}
+		}
+	}
+}
+
+func TestSectionsNestedAndRepeated(t *testing.T) {
+	type step struct {
+		Title string `section:"title"`
+		Done  bool   `section:"done,optional"`
+	}
+	type plan struct {
+		Goal  string   `section:"goal"`
+		Steps []step   `section:"step"`
+		Tags  []string `section:"tag,optional"`
+	}
+	parser := NewSections[plan]()
+	result, err := parser.ParseResponseText(`<goal>ship</goal>
+<step><title>build</title><done>yes</done></step>
+<step><title>test</title></step>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := plan{Goal: "ship", Steps: []step{{Title: "build", Done: true}, {Title: "test"}}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("expected %v but got %v", expected, result)
+	}
+
+	_, err = parser.ParseResponseText(`<step><title>build</title></step><step><done>maybe</done></step>`)
+	if !errors.Is(err, jpf.ErrInvalidResponse) {
+		t.Fatalf("expected an invalid response error, got %v", err)
+	}
+	for _, expected := range []string{
+		"missing required section <goal>",
+		"in <step> number 2: missing required section <title>",
+		`in <step> number 2: in <done>: "maybe" is not a valid boolean`,
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected error to contain %q, got:\n%v", expected, err)
+		}
+	}
+
+	instructions := SectionsInstructions[plan]()
+	for _, expected := range []string{"<goal>...</goal>", "<step> (repeat as many times as needed)", "  <title>...</title>", "<tag>...</tag> (optional, repeat"} {
+		if !strings.Contains(instructions, expected) {
+			t.Fatalf("expected instructions to contain %q, got:\n%s", expected, instructions)
+		}
+	}
+}
+
+func TestSectionsNestedTagsNotMatchedAtTopLevel(t *testing.T) {
+	type step struct {
+		Answer string `section:"answer"`
+	}
+	type out struct {
+		Steps  []step `section:"step"`
+		Answer string `section:"answer"`
+	}
+	result, err := NewSections[out]().ParseResponseText(`<step><answer>1</answer></step><step><answer>2</answer></step><answer>final</answer>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := out{Steps: []step{{Answer: "1"}, {Answer: "2"}}, Answer: "final"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("expected %v but got %v", expected, result)
+	}
+	_, err = NewSections[out]().ParseResponseText(`<step><answer>1</answer></step>`)
+	if err == nil || !strings.Contains(err.Error(), "missing required section <answer>") {
+		t.Fatalf("expected the top level answer to be missing, got %v", err)
+	}
+}
+
+type sectionsRecursiveStruct struct {
+	Name    string                    `section:"name"`
+	Replies []sectionsRecursiveStruct `section:"reply,optional"`
+}
+
+type sectionsIndirectStruct struct {
+	Child *struct {
+		Parent *sectionsIndirectStruct `section:"parent"`
+	} `section:"child"`
+}
+
+func TestSectionsPanics(t *testing.T) {
+	cases := []struct {
+		name     string
+		build    func()
+		expected string
+	}{
+		{
+			name: "unexported",
+			build: func() {
+				type unexported struct {
+					Answer string `section:"answer"`
+					notes  string `section:"notes"`
+				}
+				NewSections[unexported]()
+			},
+			expected: "field notes has a section tag but is unexported",
+		},
+		{
+			name:     "recursive",
+			build:    func() { NewSections[sectionsRecursiveStruct]() },
+			expected: "contains itself",
+		},
+		{
+			name:     "indirectly recursive",
+			build:    func() { SectionsInstructions[sectionsIndirectStruct]() },
+			expected: "contains itself",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if msg, ok := r.(string); !ok || !strings.Contains(msg, c.expected) {
+					t.Fatalf("expected a panic containing %q, got %v", c.expected, r)
+				}
+			}()
+			c.build()
+		})
+	}
+}
+
+func TestCodeBlocks(t *testing.T) {
+	blocks, err := NewCodeBlocks("GO").ParseResponseText(testingMarkdownResponse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"func a() {}\n```\n", "func b() {}\n"}
+	if !reflect.DeepEqual(blocks, expected) {
+		t.Fatalf("expected %q but got %q", expected, blocks)
+	}
+	if _, err := NewCodeBlocks("python").ParseResponseText(testingMarkdownResponse); !errors.Is(err, jpf.ErrInvalidResponse) {
+		t.Fatalf("expected an invalid response error, got %v", err)
+	}
+}
+
+func TestMarkdownTable(t *testing.T) {
+	type item struct {
+		Name     string
+		Price    float64  `table:"Unit Price"`
+		Count    int      `table:"qty"`
+		Discount *float64 `table:"Discount,optional"`
+		Notes    string   `table:"notes,optional"`
+	}
+	parser := NewMarkdownTable[item]()
+	result, err := parser.ParseResponseText(`Here are the items:
+
+| name | unit  price | Qty | Discount |
+|:-----|------------:|-----|----------|
+| Tea \| green | 1.5 | 3 | 0.1 |
+| Cake | 2 | 1 | |
+
+Let me know if you need anything else.`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 2 || result[0].Name != "Tea | green" || result[0].Price != 1.5 || result[0].Count != 3 ||
+		result[0].Discount == nil || *result[0].Discount != 0.1 || result[1].Name != "Cake" || result[1].Discount != nil {
+		t.Fatalf("unexpected table result %+v", result)
+	}
+
+	_, err = parser.ParseResponseText("| Name | Unit Price | Qty |\n|---|---|---|\n| Tea | cheap | 1 |\n| Cake | 2 | 1.5 |")
+	if !errors.Is(err, jpf.ErrInvalidResponse) {
+		t.Fatalf("expected an invalid response error, got %v", err)
+	}
+	for _, expected := range []string{`row 1, column 'Unit Price': "cheap" is not a valid number`, `row 2, column 'qty': "1.5" is not a valid integer`} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected error to contain %q, got:\n%v", expected, err)
+		}
+	}
+
+	_, err = parser.ParseResponseText("| Name | Qty |\n|---|---|\n| Tea | 1 |")
+	if err == nil || !strings.Contains(err.Error(), "missing required column 'Unit Price'") {
+		t.Fatalf("expected a missing column error, got %v", err)
+	}
+	if _, err := parser.ParseResponseText("no table here"); !errors.Is(err, jpf.ErrInvalidResponse) {
+		t.Fatalf("expected an invalid response error, got %v", err)
+	}
+}
+
+func TestRegexAll(t *testing.T) {
+	type event struct {
+		When  time.Time     `regex:"when"`
+		Took  time.Duration `regex:"took"`
+		Count *uint
+	}
+	parser := NewRegexAll[event](`(?m)^(?P<when>\S+) took (?P<took>\S+)(?: x(?P<count>\d+))?$`)
+	result, err := parser.ParseResponseText("2024-03-01 took 1m30s x2\n2024-03-02T10:00:00Z took 5s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 2 || !result[0].When.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)) || result[0].Took != 90*time.Second ||
+		result[0].Count == nil || *result[0].Count != 2 || result[1].Took != 5*time.Second || result[1].Count != nil {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	_, err = parser.ParseResponseText("2024-03-01 took 1m30s\nyesterday took 5s")
+	if !errors.Is(err, jpf.ErrInvalidResponse) || !strings.Contains(err.Error(), `in match 2: when: "yesterday" is not a valid time`) {
+		t.Fatalf("expected an invalid time error, got %v", err)
+	}
+}
+
+func TestChoiceErrorsListOptions(t *testing.T) {
+	parser := NewChoice([]string{"yes", "no"})
+	_, err := parser.ParseResponseText("yse")
+	if !errors.Is(err, jpf.ErrInvalidResponse) || !strings.Contains(err.Error(), "respond with exactly one of: yes, no") {
+		t.Fatalf("expected a no-match error listing the options, got %v", err)
+	}
+	_, err = parser.ParseResponseText("yes and no")
+	if !errors.Is(err, jpf.ErrInvalidResponse) || !strings.Contains(err.Error(), "ambiguous") {
+		t.Fatalf("expected an ambiguity error, got %v", err)
+	}
+}
+
+func TestCombinatorErrors(t *testing.T) {
+	_, err := buildTestingJsonOrYAML().ParseResponseText("a: [")
+	if !errors.Is(err, jpf.ErrInvalidResponse) || !strings.Contains(err.Error(), "format 1: ") || !strings.Contains(err.Error(), "format 2: ") {
+		t.Fatalf("expected the errors of both formats, got %v", err)
+	}
+
+	fatal := errors.New("fatal")
+	failing := Map(NewRaw(), func(string) (int, error) { return 0, fatal })
+	if _, err := OneOf(failing, NewJson[int]()).ParseResponseText("1"); !errors.Is(err, fatal) || errors.Is(err, jpf.ErrInvalidResponse) {
+		t.Fatalf("expected the fatal error to stop trying alternatives, got %v", err)
+	}
+	if _, err := WithDefault(failing, 5).ParseResponseText("1"); !errors.Is(err, fatal) {
+		t.Fatalf("expected the fatal error to be returned instead of the default, got %v", err)
+	}
+
+	parser := EachLine(NewChoice([]string{"cat", "dog"}))
+	result, err := parser.ParseResponseText("1. Cat\n\n2. dog\n")
+	if err != nil || !reflect.DeepEqual(result, []string{"cat", "dog"}) {
+		t.Fatalf("unexpected result %v (%v)", result, err)
+	}
+	_, err = parser.ParseResponseText("cat\nfish\nbird")
+	if !errors.Is(err, jpf.ErrInvalidResponse) || !strings.Contains(err.Error(), "2 of 3 parts") || !strings.Contains(err.Error(), "part 3: ") {
+		t.Fatalf("expected errors for every invalid part, got %v", err)
+	}
+}
+
+func TestStreamingJson(t *testing.T) {
+	type item struct {
+		Name string   `json:"name"`
+		Tags []string `json:"tags"`
+		N    int      `json:"n"`
+	}
+	response := "Sure! ```json\n" + `{"name": "café \"x\"", "tags": ["a", "bc"], "n": 42}` + "\n```"
+	partials := []item{}
+	parser := NewStreamingJson(func(i item) { partials = append(partials, i) })
+	parser.OnMessageBegin()
+	for _, c := range response {
+		parser.OnMessageText(string(c))
+	}
+	expected := item{Name: `café "x"`, Tags: []string{"a", "bc"}, N: 42}
+	result, err := parser.ParseResponseText(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("expected %v but got %v", expected, result)
+	}
+	if len(partials) < 5 {
+		t.Fatalf("expected many partial results, got %d", len(partials))
+	}
+	if !reflect.DeepEqual(partials[len(partials)-1], expected) {
+		t.Fatalf("expected last partial to be %v but got %v", expected, partials[len(partials)-1])
+	}
+	sawPartialName := false
+	for _, p := range partials {
+		if p.Name == "caf" {
+			sawPartialName = true
+		}
+		if p.N != 0 && p.N != 42 {
+			t.Fatalf("saw a cut short number %d", p.N)
+		}
+		if strings.HasSuffix(p.Name, `\`) {
+			t.Fatalf("saw an incomplete escape in %q", p.Name)
+		}
+	}
+	if !sawPartialName {
+		t.Fatal("expected to see a partially streamed string")
+	}
+
+	parser.OnMessageReset()
+	if _, err := parser.ParseResponseText(`{"name": "x"`); !errors.Is(err, jpf.ErrInvalidResponse) {
+		t.Fatalf("expected an invalid response for incomplete json, got %v", err)
+	}
+}
+
+func TestCompletePartialJson(t *testing.T) {
+	cases := []struct{ in, expected string }{
+		{`{`, `{}`},
+		{`{"a`, `{}`},
+		{`{"a":`, `{}`},
+		{`{"a": "x`, `{"a": "x"}`},
+		{`{"a": "x\`, `{"a": "x"}`},
+		{`{"a": "x\u00`, `{"a": "x"}`},
+		{`{"a": 1`, `{}`},
+		{`{"a": 1,`, `{"a": 1}`},
+		{`{"a": [1, {"b": tr`, `{"a": [1, {}]}`},
+		{`[{"a": 1}, {"a"`, `[{"a": 1}, {}]`},
+		{`{"a": 1} trailing {"b": 2}`, `{"a": 1}`},
+	}
+	for _, c := range cases {
+		opener := c.in[0]
+		got, ok := completePartialJson(c.in, opener)
+		if !ok || got != c.expected {
+			t.Fatalf("completing %q: expected %q but got %q (ok=%v)", c.in, c.expected, got, ok)
+		}
+	}
+}
+
+func TestJsonSchemaReportsAllViolations(t *testing.T) {
+	parser := NewValidatedJson[schemaTestStruct]()
+	_, err := parser.ParseResponseText(`{"label": "meh", "code": "abc", "extra": 1}`)
+	if !errors.Is(err, jpf.ErrInvalidResponse) {
+		t.Fatalf("expected an invalid response error, got %v", err)
+	}
+	for _, expected := range []string{
+		"missing required field 'score'",
+		"unknown field 'extra'",
+		`the string "meh" is not one of the allowed values ["positive", "negative"]`,
+		`at 'code': the string "abc" does not match the pattern`,
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected error to contain %q, got:\n%v", expected, err)
+		}
+	}
+}
+
+func TestRepairJson(t *testing.T) {
+	cases := []struct {
+		in       string
+		expected string
+		repairs  []JsonRepair
+	}{
+		{`{"a": 1}`, `{"a": 1}`, nil},
+		{`{"a": [1, 2,],}`, `{"a": [1, 2]}`, []JsonRepair{RepairTrailingComma}},
+		{`{'a': 'say "hi"'}`, `{"a": "say \"hi\""}`, []JsonRepair{RepairSingleQuotes}},
+		{"{\"a\": \"x\ny\"}", `{"a": "x\ny"}`, []JsonRepair{RepairControlCharacter}},
+		{"{/* note */\"a\": 1 // one\n}", "{\"a\": 1 \n}", []JsonRepair{RepairComment}},
+		{`{a: True, b_2: None}`, `{"a": true, "b_2": null}`, []JsonRepair{RepairUnquotedKey, RepairPythonLiteral}},
+		{`{"a": [{"b": "c\`, `{"a": [{"b": "c"}]}`, []JsonRepair{RepairUnclosedString, RepairUnclosedBracket}},
+		{`{"a": 1, "b":`, `{"a": 1, "b":null}`, []JsonRepair{RepairMissingValue, RepairUnclosedBracket}},
+		{`[1, 2, `, `[1, 2]`, []JsonRepair{RepairTrailingComma, RepairUnclosedBracket}},
+	}
+	for _, c := range cases {
+		got, repairs, err := repairJson(c.in, c.in[0])
+		if err != nil {
+			t.Fatalf("repairing %q: unexpected error %v", c.in, err)
+		}
+		if got != c.expected || !reflect.DeepEqual(repairs, c.repairs) {
+			t.Fatalf("repairing %q: expected %q %v but got %q %v", c.in, c.expected, c.repairs, got, repairs)
+		}
+	}
+}
+
+func TestRepairingJsonReportsRepairs(t *testing.T) {
+	var reported []JsonRepair
+	parser := NewRepairingJson[utils.TestStruct](OnRepair(func(r []JsonRepair) { reported = r }))
+	if _, err := parser.ParseResponseText(`{"a": 1,}`); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reported, []JsonRepair{RepairTrailingComma}) {
+		t.Fatalf("expected a trailing comma repair to be reported, got %v", reported)
+	}
+
+	strict := NewRepairingJson[utils.TestStruct](WithRepairsAsErrors())
+	_, err := strict.ParseResponseText(`{'a': 1,}`)
+	if !errors.Is(err, jpf.ErrInvalidResponse) {
+		t.Fatalf("expected an invalid response error, got %v", err)
+	}
+	for _, expected := range []string{"single quotes", "trailing comma"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected error to contain %q, got:\n%v", expected, err)
+		}
+	}
+}
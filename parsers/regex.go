@@ -0,0 +1,174 @@
+package parsers
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/internal/utils"
+)
+
+// NewRegex creates a [Parser] that finds a match of the pattern in the response, and fills the fields of a struct from its named capture groups.
+// Groups are mapped to fields with the regex struct tag if present (for example `regex:"label"`), or by field name (case-insensitive) otherwise.
+// The tag may restrict a field to a set of values with enum, for example `regex:"label,enum=positive|negative"`,
+// which are matched case-insensitively and stored as written in the tag.
+// Fields may be strings, numbers, bools, times, durations or types implementing [encoding.TextUnmarshaler], or pointers to these.
+// Groups that did not take part in the match leave their field unset.
+// By default the first match is used, see [WithLastMatch] to use the last one instead, or use [NewRegexAll] to parse every match.
+// T must be a struct, and NewRegex panics if the pattern is invalid, a tagged field has no matching group, or a mapped field has an unsupported type.
+func NewRegex[T any](pattern string, opts ...RegexOpt) jpf.Parser[T] {
+	p := &regexParser[T]{
+		pattern: regexp.MustCompile(pattern),
+	}
+	p.fields = regexFieldsOf[T](p.pattern, "NewRegex")
+	for _, o := range opts {
+		o(&p.settings)
+	}
+	return p
+}
+
+// NewRegexAll creates a [Parser] like [NewRegex], but that parses every non-overlapping match of the pattern, in order.
+// At least one match is required.
+func NewRegexAll[T any](pattern string) jpf.Parser[[]T] {
+	p := &regexAllParser[T]{
+		pattern: regexp.MustCompile(pattern),
+	}
+	p.fields = regexFieldsOf[T](p.pattern, "NewRegexAll")
+	return p
+}
+
+type RegexOpt func(*regexSettings)
+
+type regexSettings struct {
+	last bool
+}
+
+// Use the last match of the pattern instead of the first, which is useful when the answer comes after some reasoning that may also match.
+func WithLastMatch() RegexOpt {
+	return func(s *regexSettings) { s.last = true }
+}
+
+type regexField struct {
+	index int
+	group int
+	name  string
+	enum  []string
+}
+
+func regexFieldsOf[T any](pattern *regexp.Regexp, constructor string) []regexField {
+	typ := reflect.TypeFor[T]()
+	if typ.Kind() != reflect.Struct {
+		panic(constructor + ": T must be a struct")
+	}
+	groups := pattern.SubexpNames()
+	fields := []regexField{}
+	for i := range typ.NumField() {
+		f := typ.Field(i)
+		tag, tagged := f.Tag.Lookup("regex")
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		group := slices.IndexFunc(groups, func(g string) bool { return g != "" && strings.EqualFold(g, name) })
+		if group == -1 {
+			if tagged {
+				panic(fmt.Sprintf("%s: pattern has no capture group named %s for field %s", constructor, name, f.Name))
+			}
+			continue
+		}
+		if !canSetFromText(f.Type) {
+			panic(fmt.Sprintf("%s: field %s has unsupported type %s", constructor, f.Name, f.Type))
+		}
+		field := regexField{index: i, group: group, name: groups[group]}
+		if enum, ok := strings.CutPrefix(options, "enum="); ok {
+			field.enum = strings.Split(enum, "|")
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+type regexParser[T any] struct {
+	pattern  *regexp.Regexp
+	fields   []regexField
+	settings regexSettings
+}
+
+func (p *regexParser[T]) ParseResponseText(response string) (T, error) {
+	var result T
+	var match []int
+	if p.settings.last {
+		matches := p.pattern.FindAllStringSubmatchIndex(response, -1)
+		if len(matches) > 0 {
+			match = matches[len(matches)-1]
+		}
+	} else {
+		match = p.pattern.FindStringSubmatchIndex(response)
+	}
+	if match == nil {
+		return result, noRegexMatch(p.pattern)
+	}
+	if errs := fillFromRegexMatch(response, match, p.fields, reflect.ValueOf(&result).Elem()); len(errs) > 0 {
+		var zero T
+		return zero, utils.Wrap(errors.Join(append(errs, jpf.ErrInvalidResponse)...), "llm returned invalid values")
+	}
+	return result, nil
+}
+
+type regexAllParser[T any] struct {
+	pattern *regexp.Regexp
+	fields  []regexField
+}
+
+func (p *regexAllParser[T]) ParseResponseText(response string) ([]T, error) {
+	matches := p.pattern.FindAllStringSubmatchIndex(response, -1)
+	if len(matches) == 0 {
+		return nil, noRegexMatch(p.pattern)
+	}
+	results := make([]T, len(matches))
+	errs := []error{}
+	for i, match := range matches {
+		for _, err := range fillFromRegexMatch(response, match, p.fields, reflect.ValueOf(&results[i]).Elem()) {
+			errs = append(errs, fmt.Errorf("in match %d: %w", i+1, err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, utils.Wrap(errors.Join(append(errs, jpf.ErrInvalidResponse)...), "llm returned invalid values")
+	}
+	return results, nil
+}
+
+func noRegexMatch(pattern *regexp.Regexp) error {
+	return utils.Wrap(jpf.ErrInvalidResponse, "response did not contain any text in the expected format (matching the regular expression %s)", pattern)
+}
+
+// fillFromRegexMatch sets the fields of v from the groups of the match, returning every conversion error.
+func fillFromRegexMatch(text string, match []int, fields []regexField, v reflect.Value) []error {
+	errs := []error{}
+	for _, field := range fields {
+		start, end := match[2*field.group], match[2*field.group+1]
+		if start == -1 {
+			continue
+		}
+		value := strings.TrimSpace(text[start:end])
+		if field.enum != nil {
+			i := slices.IndexFunc(field.enum, func(e string) bool { return strings.EqualFold(e, value) })
+			if i == -1 {
+				errs = append(errs, fmt.Errorf("%s: %q is not one of the allowed values %s", field.name, value, strings.Join(field.enum, ", ")))
+				continue
+			}
+			value = field.enum[i]
+		}
+		if err := setFromText(v.Field(field.index), value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field.name, err))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,211 @@
+package parsers
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/internal/utils"
+)
+
+// NewSections creates a [Parser] that reads xml-like tagged sections of the response, such as <reasoning>...</reasoning><answer>...</answer>, into the fields of a struct.
+// Fields are mapped to tags with the section struct tag, for example `section:"answer"`, and fields without the tag are ignored.
+// Sections are required unless the tag includes optional, for example `section:"notes,optional"`.
+// A slice field collects every occurrence of its tag, and a struct field (or slice of structs) is parsed from the sections nested inside its tag.
+// Other fields may be strings, numbers, bools, times, durations or types implementing [encoding.TextUnmarshaler].
+// Unlike xml, the text between tags does not need escaping, and any text outside the tags is ignored.
+// Missing sections and conversion errors are all returned together, joined with [jpf.ErrInvalidResponse].
+// T must be a struct, and NewSections panics if any tagged field is unexported or has an unsupported type, or if a section type contains itself.
+func NewSections[T any]() jpf.Parser[T] {
+	typ := reflect.TypeFor[T]()
+	if typ.Kind() != reflect.Struct {
+		panic("NewSections: T must be a struct")
+	}
+	return &sectionsParser[T]{
+		fields: sectionFieldsOf(typ, "NewSections", nil),
+	}
+}
+
+// SectionsInstructions returns a prompt snippet describing the tagged sections of T, for use in an encoder.
+func SectionsInstructions[T any]() string {
+	typ := reflect.TypeFor[T]()
+	if typ.Kind() != reflect.Struct {
+		panic("SectionsInstructions: T must be a struct")
+	}
+	b := &strings.Builder{}
+	b.WriteString("Respond using the following tagged sections:\n")
+	writeSectionsInstructions(b, sectionFieldsOf(typ, "SectionsInstructions", nil), "")
+	return strings.TrimRight(b.String(), "\n")
+}
+
+type sectionsParser[T any] struct {
+	fields []sectionField
+}
+
+type sectionField struct {
+	index    int
+	name     string
+	optional bool
+	repeated bool
+	// The fields of the nested sections, if the field is a struct.
+	nested  []sectionField
+	pattern *regexp.Regexp
+	opening *regexp.Regexp
+}
+
+// sectionFieldsOf reads the section fields of a struct type. Parents are the struct types whose sections the type is nested in.
+func sectionFieldsOf(typ reflect.Type, constructor string, parents []reflect.Type) []sectionField {
+	if slices.Contains(parents, typ) {
+		panic(fmt.Sprintf("%s: section type %s contains itself, so its sections could be nested forever", constructor, typ))
+	}
+	parents = append(parents, typ)
+	fields := []sectionField{}
+	for i := range typ.NumField() {
+		f := typ.Field(i)
+		tag, ok := f.Tag.Lookup("section")
+		if !ok || tag == "-" {
+			continue
+		}
+		if !f.IsExported() {
+			panic(fmt.Sprintf("%s: field %s has a section tag but is unexported", constructor, f.Name))
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			panic(fmt.Sprintf("%s: field %s has an empty section name", constructor, f.Name))
+		}
+		field := sectionField{
+			index:    i,
+			name:     name,
+			optional: options == "optional",
+			pattern:  regexp.MustCompile(`(?is)<` + regexp.QuoteMeta(name) + `(?:\s[^>]*)?>(.*?)</` + regexp.QuoteMeta(name) + `\s*>`),
+			opening:  regexp.MustCompile(`(?i)<` + regexp.QuoteMeta(name) + `(?:\s[^>]*)?>`),
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Slice && ft.Elem().Kind() != reflect.Uint8 {
+			field.repeated = true
+			ft = ft.Elem()
+		}
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		switch {
+		case canSetFromText(ft):
+		case ft.Kind() == reflect.Struct:
+			field.nested = sectionFieldsOf(ft, constructor, parents)
+		default:
+			panic(fmt.Sprintf("%s: field %s has unsupported type %s", constructor, f.Name, f.Type))
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func (p *sectionsParser[T]) ParseResponseText(response string) (T, error) {
+	var result T
+	errs := parseSections(response, p.fields, reflect.ValueOf(&result).Elem())
+	if len(errs) > 0 {
+		var zero T
+		return zero, utils.Wrap(errors.Join(append(errs, jpf.ErrInvalidResponse)...), "llm response did not contain the expected sections")
+	}
+	return result, nil
+}
+
+// parseSections fills the fields of v from the sections in text, returning every problem found.
+func parseSections(text string, fields []sectionField, v reflect.Value) []error {
+	errs := []error{}
+	// The sections of nested structs are hidden from the other fields, so that tags inside them are not mistaken for tags at this level.
+	nestedSpans := make([][][]int, len(fields))
+	for i, field := range fields {
+		if field.nested != nil {
+			nestedSpans[i] = field.pattern.FindAllStringIndex(text, -1)
+		}
+	}
+	for i, field := range fields {
+		visible := hideSpans(text, slices.Concat(slices.Delete(slices.Clone(nestedSpans), i, i+1)...))
+		matches := field.pattern.FindAllStringSubmatch(visible, -1)
+		if len(matches) == 0 {
+			if field.optional {
+				continue
+			}
+			if field.opening.MatchString(visible) {
+				errs = append(errs, fmt.Errorf("section <%s> was opened but never closed with </%s>", field.name, field.name))
+			} else {
+				errs = append(errs, fmt.Errorf("missing required section <%s>", field.name))
+			}
+			continue
+		}
+		fv := v.Field(field.index)
+		if !field.repeated {
+			for _, err := range parseSection(matches[0][1], field, fv) {
+				errs = append(errs, fmt.Errorf("in <%s>: %w", field.name, err))
+			}
+			continue
+		}
+		items := reflect.MakeSlice(fv.Type(), len(matches), len(matches))
+		for i, m := range matches {
+			for _, err := range parseSection(m[1], field, items.Index(i)) {
+				errs = append(errs, fmt.Errorf("in <%s> number %d: %w", field.name, i+1, err))
+			}
+		}
+		fv.Set(items)
+	}
+	return errs
+}
+
+// hideSpans replaces the text in each span with spaces, keeping the positions of the rest of the text.
+func hideSpans(text string, spans [][]int) string {
+	if len(spans) == 0 {
+		return text
+	}
+	b := []byte(text)
+	for _, span := range spans {
+		for i := span[0]; i < span[1]; i++ {
+			b[i] = ' '
+		}
+	}
+	return string(b)
+}
+
+// parseSection fills v from the contents of a single section.
+func parseSection(content string, field sectionField, v reflect.Value) []error {
+	if field.nested == nil {
+		if err := setFromText(v, content); err != nil {
+			return []error{err}
+		}
+		return nil
+	}
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return parseSections(content, field.nested, v)
+}
+
+func writeSectionsInstructions(b *strings.Builder, fields []sectionField, indent string) {
+	for _, field := range fields {
+		notes := []string{}
+		if field.optional {
+			notes = append(notes, "optional")
+		}
+		if field.repeated {
+			notes = append(notes, "repeat as many times as needed")
+		}
+		note := ""
+		if len(notes) > 0 {
+			note = " (" + strings.Join(notes, ", ") + ")"
+		}
+		if field.nested == nil {
+			fmt.Fprintf(b, "%s<%s>...</%s>%s\n", indent, field.name, field.name, note)
+			continue
+		}
+		fmt.Fprintf(b, "%s<%s>%s\n", indent, field.name, note)
+		writeSectionsInstructions(b, field.nested, indent+"  ")
+		fmt.Fprintf(b, "%s</%s>\n", indent, field.name)
+	}
+}
@@ -1,6 +1,7 @@
 package parsers
 
 import (
+	"context"
 	"errors"
 	"strings"
 
@@ -10,6 +11,7 @@ import (
 // Wrap an existing [Parser] with one that takes only the part of interest of the response into account.
 // The part of interest is determined by the substring function.
 // If an error is detected when getting the substring, [ErrInvalidResponse] is raised.
+// Like the other wrapping parsers in this package, it is a [jpf.ContextParser] that passes on the context and usage of the parser it wraps.
 func Substring[T any](parser jpf.Parser[T], substring func(string) (string, error)) jpf.Parser[T] {
 	return &substringParser[T]{
 		decoder:   parser,
@@ -46,10 +48,15 @@ type substringParser[T any] struct {
 }
 
 func (srd *substringParser[T]) ParseResponseText(resp string) (T, error) {
+	result, _, err := srd.ParseResponseTextContext(context.Background(), resp)
+	return result, err
+}
+
+func (srd *substringParser[T]) ParseResponseTextContext(ctx context.Context, resp string) (T, jpf.Usage, error) {
 	var zero T
 	sub, err := srd.substring(resp)
 	if err != nil {
-		return zero, errors.Join(err, jpf.ErrInvalidResponse)
+		return zero, jpf.Usage{}, errors.Join(err, jpf.ErrInvalidResponse)
 	}
-	return srd.decoder.ParseResponseText(sub)
+	return jpf.ParserWithContext(srd.decoder).ParseResponseTextContext(ctx, sub)
 }
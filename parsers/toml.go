@@ -0,0 +1,43 @@
+package parsers
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/internal/utils"
+)
+
+// NewTOML creates a [Parser] that parses a toml document from the response.
+// If the response contains a ```toml fenced code block, only the contents of that block are parsed.
+// Fields are named using toml struct tags, see [github.com/BurntSushi/toml].
+func NewTOML[T any]() jpf.Parser[T] {
+	return &tomlParser[T]{}
+}
+
+// TOMLInstructions returns a prompt snippet asking for a toml response with the structure of T, for use in an encoder.
+func TOMLInstructions[T any]() string {
+	var zero T
+	example := bytes.NewBuffer(nil)
+	if err := toml.NewEncoder(example).Encode(zero); err != nil {
+		panic("TOMLInstructions: " + err.Error())
+	}
+	return "Respond with a toml document inside a ```toml code block, with the following structure:\n```toml\n" + example.String() + "```"
+}
+
+type tomlParser[T any] struct{}
+
+func (p *tomlParser[T]) ParseResponseText(response string) (T, error) {
+	var result T
+	block := fencedBlock(response, "toml")
+	if strings.TrimSpace(block) == "" {
+		return result, utils.Wrap(jpf.ErrInvalidResponse, "response did not contain a toml document")
+	}
+	if _, err := toml.Decode(block, &result); err != nil {
+		var zero T
+		return zero, utils.Wrap(errors.Join(err, jpf.ErrInvalidResponse), "llm returned invalid toml")
+	}
+	return result, nil
+}
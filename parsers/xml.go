@@ -0,0 +1,44 @@
+package parsers
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/internal/utils"
+)
+
+// NewXML creates a [Parser] that parses an xml document from the response.
+// If the response contains a ```xml fenced code block, only the contents of that block are parsed,
+// otherwise the text from the first '<' to the last '>' is parsed.
+// Fields are named using xml struct tags, see [encoding/xml].
+func NewXML[T any]() jpf.Parser[T] {
+	return &xmlParser[T]{}
+}
+
+// XMLInstructions returns a prompt snippet asking for an xml response with the structure of T, for use in an encoder.
+func XMLInstructions[T any]() string {
+	var zero T
+	example, err := xml.MarshalIndent(zero, "", "  ")
+	if err != nil {
+		panic("XMLInstructions: " + err.Error())
+	}
+	return "Respond with an xml document inside a ```xml code block, with the following structure:\n```xml\n" + string(example) + "\n```"
+}
+
+type xmlParser[T any] struct{}
+
+func (p *xmlParser[T]) ParseResponseText(response string) (T, error) {
+	var result T
+	block := fencedBlock(response, "xml")
+	start, end := strings.Index(block, "<"), strings.LastIndex(block, ">")
+	if start == -1 || end < start {
+		return result, utils.Wrap(jpf.ErrInvalidResponse, "response did not contain an xml document")
+	}
+	if err := xml.Unmarshal([]byte(block[start:end+1]), &result); err != nil {
+		var zero T
+		return zero, utils.Wrap(errors.Join(err, jpf.ErrInvalidResponse), "llm returned invalid xml")
+	}
+	return result, nil
+}
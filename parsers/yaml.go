@@ -0,0 +1,42 @@
+package parsers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/internal/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// NewYAML creates a [Parser] that parses a yaml document from the response.
+// If the response contains a ```yaml (or ```yml) fenced code block, only the contents of that block are parsed.
+// Fields are named using yaml struct tags, see [gopkg.in/yaml.v3].
+func NewYAML[T any]() jpf.Parser[T] {
+	return &yamlParser[T]{}
+}
+
+// YAMLInstructions returns a prompt snippet asking for a yaml response with the structure of T, for use in an encoder.
+func YAMLInstructions[T any]() string {
+	var zero T
+	example, err := yaml.Marshal(zero)
+	if err != nil {
+		panic("YAMLInstructions: " + err.Error())
+	}
+	return "Respond with a yaml document inside a ```yaml code block, with the following structure:\n```yaml\n" + string(example) + "```"
+}
+
+type yamlParser[T any] struct{}
+
+func (p *yamlParser[T]) ParseResponseText(response string) (T, error) {
+	var result T
+	block := fencedBlock(response, "yaml", "yml")
+	if strings.TrimSpace(block) == "" {
+		return result, utils.Wrap(jpf.ErrInvalidResponse, "response did not contain a yaml document")
+	}
+	if err := yaml.Unmarshal([]byte(block), &result); err != nil {
+		var zero T
+		return zero, utils.Wrap(errors.Join(err, jpf.ErrInvalidResponse), "llm returned invalid yaml")
+	}
+	return result, nil
+}
@@ -0,0 +1,269 @@
+package pipelines
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/internal/utils"
+)
+
+// BatchResult is the outcome of running a pipeline on one input of a batch.
+type BatchResult[U any] struct {
+	// The position of the input in the batch.
+	Index int
+	// The result of the pipeline, if it succeeded.
+	Result U
+	// The usage of the pipeline for this input.
+	Usage jpf.Usage
+	// The error returned by the pipeline for this input. Other inputs are still processed when one fails.
+	Err error
+	// Whether the result was loaded from a checkpoint, instead of by calling the pipeline.
+	Resumed bool
+}
+
+// BatchProgress describes how far through a batch is, and is passed to the callback of [WithProgress].
+type BatchProgress struct {
+	// The number of inputs that have finished, including those that failed or were resumed.
+	Done int
+	// The number of inputs that failed.
+	Failed int
+	// The number of inputs in the batch, or -1 if it is not known (when the inputs are a channel).
+	Total int
+	// The usage so far, not including resumed results.
+	Usage jpf.Usage
+}
+
+type BatchOpt func(*batchSettings)
+
+type batchSettings struct {
+	concurrency int
+	ordered     bool
+	progress    func(BatchProgress)
+	checkpoint  string
+	total       int
+}
+
+// Run the pipeline on at most n inputs at the same time, which defaults to 4.
+func WithBatchConcurrency(n int) BatchOpt {
+	return func(s *batchSettings) { s.concurrency = max(n, 1) }
+}
+
+// Send results from [BatchChannel] in the same order as the inputs, instead of as soon as they finish.
+// Results from [Batch] are always in order.
+func WithOrderedResults() BatchOpt {
+	return func(s *batchSettings) { s.ordered = true }
+}
+
+// Call the callback every time an input finishes. It is never called concurrently.
+func WithProgress(callback func(BatchProgress)) BatchOpt {
+	return func(s *batchSettings) { s.progress = callback }
+}
+
+// Save every successful result to the file, so that if the batch is stopped, running it again with the same inputs and file
+// resumes where it left off. Failed inputs are not saved, so they are retried.
+// The file is json lines, so results must be json encodable, and inputs are identified by their position and a hash of their json.
+func WithCheckpoint(path string) BatchOpt {
+	return func(s *batchSettings) { s.checkpoint = path }
+}
+
+var errNotProcessed = errors.New("input was not processed because the batch stopped early")
+
+// Batch runs the pipeline on every input with bounded concurrency, returning a result for every input in order, and the total usage.
+// An input failing does not stop the batch, and its error is in its result.
+// An error is only returned if the batch stopped early, because the context was cancelled or the checkpoint could not be used,
+// in which case the results of inputs that were not processed have an error saying so.
+// The total usage does not include resumed results, as it was spent in a previous run.
+func Batch[T, U any](ctx context.Context, pipeline jpf.Pipeline[T, U], inputs []T, opts ...BatchOpt) ([]BatchResult[U], jpf.Usage, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	inputChan := make(chan T)
+	go func() {
+		defer close(inputChan)
+		for _, input := range inputs {
+			select {
+			case inputChan <- input:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	opts = append(slices.Clone(opts), func(s *batchSettings) { s.total = len(inputs) })
+	resultChan, wait := BatchChannel(ctx, pipeline, inputChan, opts...)
+	results := make([]BatchResult[U], len(inputs))
+	for i := range results {
+		results[i] = BatchResult[U]{Index: i, Err: errNotProcessed}
+	}
+	for result := range resultChan {
+		results[result.Index] = result
+	}
+	usage, err := wait()
+	return results, usage, err
+}
+
+// BatchChannel runs the pipeline on every input received from the channel with bounded concurrency, until the channel is closed.
+// Results are sent to the returned channel as they finish (or in order, with [WithOrderedResults]), and it is closed when the batch is done.
+// After the results channel is closed, wait returns the total usage, and an error if the batch stopped early
+// (because the context was cancelled or the checkpoint could not be used). An input failing does not stop the batch, and its error is in its result.
+// The results must be received for the batch to make progress.
+func BatchChannel[T, U any](ctx context.Context, pipeline jpf.Pipeline[T, U], inputs <-chan T, opts ...BatchOpt) (results <-chan BatchResult[U], wait func() (jpf.Usage, error)) {
+	settings := batchSettings{concurrency: 4, total: -1}
+	for _, o := range opts {
+		o(&settings)
+	}
+	b := &batchRun[T, U]{
+		pipeline: pipeline,
+		settings: settings,
+		finished: make(chan BatchResult[U], settings.concurrency),
+		results:  make(chan BatchResult[U]),
+		done:     make(chan struct{}),
+	}
+	b.ctx, b.cancel = context.WithCancel(ctx)
+	go b.run(inputs)
+	return b.results, func() (jpf.Usage, error) {
+		<-b.done
+		return b.usage, b.err
+	}
+}
+
+type batchRun[T, U any] struct {
+	pipeline   jpf.Pipeline[T, U]
+	settings   batchSettings
+	ctx        context.Context
+	cancel     context.CancelFunc
+	checkpoint *batchCheckpoint[U]
+	// finished receives results from the workers, in the order they finish.
+	finished chan BatchResult[U]
+	// results sends results to the caller.
+	results chan BatchResult[U]
+	done    chan struct{}
+	usage   jpf.Usage
+	errLock sync.Mutex
+	err     error
+}
+
+// fail stops the batch early, keeping the first reason it was stopped.
+func (b *batchRun[T, U]) fail(err error) {
+	b.errLock.Lock()
+	defer b.errLock.Unlock()
+	if b.err == nil {
+		b.err = err
+	}
+	b.cancel()
+}
+
+func (b *batchRun[T, U]) run(inputs <-chan T) {
+	defer close(b.done)
+	defer b.cancel()
+	defer close(b.results)
+	if b.settings.checkpoint != "" {
+		checkpoint, err := openBatchCheckpoint[U](b.settings.checkpoint)
+		if err != nil {
+			b.fail(utils.Wrap(err, "failed to open checkpoint"))
+			return
+		}
+		defer checkpoint.Close()
+		b.checkpoint = checkpoint
+	}
+	go b.dispatch(inputs)
+	b.collect()
+}
+
+// dispatch starts a worker for each input (or resumes it from the checkpoint), closing finished once every worker is done.
+func (b *batchRun[T, U]) dispatch(inputs <-chan T) {
+	defer close(b.finished)
+	sem := make(chan struct{}, b.settings.concurrency)
+	var workers sync.WaitGroup
+	defer workers.Wait()
+	for index := 0; ; index++ {
+		var input T
+		var ok bool
+		select {
+		case input, ok = <-inputs:
+		case <-b.ctx.Done():
+			ok = false
+		}
+		if !ok {
+			if err := b.ctx.Err(); err != nil {
+				b.fail(err)
+			}
+			return
+		}
+		var hash string
+		if b.checkpoint != nil {
+			var err error
+			hash, err = hashBatchInput(input)
+			if err != nil {
+				b.fail(utils.Wrap(err, "failed to hash input %d for the checkpoint", index))
+				return
+			}
+			if result, ok, err := b.checkpoint.Lookup(index, hash); err != nil {
+				b.fail(utils.Wrap(err, "checkpoint does not match the inputs"))
+				return
+			} else if ok {
+				b.finished <- result
+				continue
+			}
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-b.ctx.Done():
+			b.fail(b.ctx.Err())
+			return
+		}
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			defer func() { <-sem }()
+			resp, err := b.pipeline.Call(b.ctx, input)
+			result := BatchResult[U]{Index: index, Result: resp.Result, Usage: resp.Usage, Err: err}
+			if err == nil && b.checkpoint != nil {
+				if err := b.checkpoint.Save(hash, result); err != nil {
+					b.fail(utils.Wrap(err, "failed to save input %d to the checkpoint", index))
+				}
+			}
+			b.finished <- result
+		}()
+	}
+}
+
+// collect reports progress for each finished result and sends it to the caller, reordering results if needed.
+func (b *batchRun[T, U]) collect() {
+	progress := BatchProgress{Total: b.settings.total}
+	pending := make(map[int]BatchResult[U])
+	next := 0
+	for result := range b.finished {
+		progress.Done++
+		if result.Err != nil {
+			progress.Failed++
+		}
+		if !result.Resumed {
+			b.usage = b.usage.Add(result.Usage)
+			progress.Usage = b.usage
+		}
+		if b.settings.progress != nil {
+			b.settings.progress(progress)
+		}
+		if !b.settings.ordered {
+			b.results <- result
+			continue
+		}
+		pending[result.Index] = result
+		for {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			b.results <- r
+			delete(pending, next)
+			next++
+		}
+	}
+	// If the batch stopped early, there may be gaps, so send whatever is left in order.
+	for _, index := range slices.Sorted(maps.Keys(pending)) {
+		b.results <- pending[index]
+	}
+}
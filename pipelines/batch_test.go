@@ -0,0 +1,115 @@
+package pipelines
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/JoshPattman/jpf"
+)
+
+// upperOrFail uppercases its input, failing on inputs that start with "fail".
+var upperOrFail = pipelineFunc[string, string](func(_ context.Context, input string) (jpf.PipelineResponse[string], error) {
+	usage := jpf.Usage{SuccessfulCalls: 1}
+	if strings.HasPrefix(input, "fail") {
+		return jpf.PipelineResponse[string]{Usage: usage}, errors.New("cannot process " + input)
+	}
+	return jpf.PipelineResponse[string]{Result: strings.ToUpper(input), Usage: usage}, nil
+})
+
+func TestBatch(t *testing.T) {
+	progress := make([]BatchProgress, 0)
+	inputs := []string{"a", "fail b", "c", "d", "fail e"}
+	results, usage, err := Batch(context.Background(), upperOrFail, inputs, WithBatchConcurrency(2), WithProgress(func(p BatchProgress) {
+		progress = append(progress, p)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"A", "", "C", "D", ""}
+	for i, result := range results {
+		if result.Index != i || result.Result != expected[i] || (result.Err != nil) != strings.HasPrefix(inputs[i], "fail") {
+			t.Fatalf("unexpected result %d: %+v", i, result)
+		}
+	}
+	if usage.SuccessfulCalls != 5 {
+		t.Fatalf("expected the usage of 5 calls, got %v", usage)
+	}
+	last := progress[len(progress)-1]
+	if len(progress) != 5 || last.Done != 5 || last.Failed != 2 || last.Total != 5 || last.Usage != usage {
+		t.Fatalf("unexpected progress %+v", progress)
+	}
+}
+
+func TestBatchChannel(t *testing.T) {
+	for _, ordered := range []bool{false, true} {
+		inputs := make(chan string)
+		go func() {
+			defer close(inputs)
+			for _, s := range []string{"a", "b", "c", "d", "e", "f"} {
+				inputs <- s
+			}
+		}()
+		opts := []BatchOpt{WithBatchConcurrency(3)}
+		if ordered {
+			opts = append(opts, WithOrderedResults())
+		}
+		results, wait := BatchChannel(context.Background(), upperOrFail, inputs, opts...)
+		var joined strings.Builder
+		seen := make(map[int]bool)
+		for result := range results {
+			if ordered && result.Index != len(seen) {
+				t.Fatalf("expected result %d next, got %d", len(seen), result.Index)
+			}
+			seen[result.Index] = true
+			joined.WriteString(result.Result)
+		}
+		usage, err := wait()
+		if err != nil || usage.SuccessfulCalls != 6 || len(seen) != 6 {
+			t.Fatalf("expected 6 results with usage, got %d results with %v (%v)", len(seen), usage, err)
+		}
+		if ordered && joined.String() != "ABCDEF" {
+			t.Fatalf("expected ordered results, got %s", joined.String())
+		}
+	}
+}
+
+func TestBatchCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.jsonl")
+	_, _, err := Batch(context.Background(), upperOrFail, []string{"a", "fail b", "c"}, WithCheckpoint(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash part way through writing an entry.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"index":1,"inp`)
+	f.Close()
+
+	results, usage, err := Batch(context.Background(), upperOrFail, []string{"a", "b", "c", "d"}, WithCheckpoint(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.SuccessfulCalls != 2 {
+		t.Fatalf("expected only the failed and new inputs to be run, got usage %v", usage)
+	}
+	for i, expected := range []string{"A", "B", "C", "D"} {
+		if results[i].Result != expected || results[i].Err != nil || results[i].Resumed != (i == 0 || i == 2) {
+			t.Fatalf("unexpected result %d: %+v", i, results[i])
+		}
+	}
+
+	results, _, err = Batch(context.Background(), upperOrFail, []string{"a", "changed", "c"}, WithCheckpoint(path))
+	if err == nil || !strings.Contains(err.Error(), "input 1 has changed") {
+		t.Fatalf("expected an error about changed inputs, got %v", err)
+	}
+	if !errors.Is(results[2].Err, errNotProcessed) {
+		t.Fatalf("expected inputs after the mismatch not to be processed, got %+v", results[2])
+	}
+}
@@ -0,0 +1,155 @@
+package pipelines
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/internal/utils"
+	"github.com/JoshPattman/jpf/validators"
+)
+
+// Scorer rates how good a parsed response is for the input, where higher scores are better.
+// If the response should not be considered at all, the error should wrap [jpf.ErrInvalidResponse].
+// Any other error stops the pipeline using the scorer.
+type Scorer[T, U any] interface {
+	Score(ctx context.Context, input T, output U) (float64, jpf.Usage, error)
+}
+
+// ScorerFunc is a [Scorer] that calls the function, for scores that can be calculated locally.
+type ScorerFunc[T, U any] func(input T, output U) float64
+
+func (f ScorerFunc[T, U]) Score(_ context.Context, input T, output U) (float64, jpf.Usage, error) {
+	return f(input, output), jpf.Usage{}, nil
+}
+
+// NewJudgeScorer creates a [Scorer] that asks a second model to score the response.
+// The encoder builds the judging prompt from the input and parsed response, and the parser reads the score from the judge's response
+// (for example, parsers.NewJson[float64]()). See [validators.AskJudge] for how the judge is called.
+func NewJudgeScorer[T, U any](model jpf.Model, encoder jpf.Encoder[validators.JudgeInput[T, U]], parser jpf.Parser[float64]) Scorer[T, U] {
+	return &judgeScorer[T, U]{
+		model:   model,
+		encoder: encoder,
+		parser:  parser,
+	}
+}
+
+type judgeScorer[T, U any] struct {
+	model   jpf.Model
+	encoder jpf.Encoder[validators.JudgeInput[T, U]]
+	parser  jpf.Parser[float64]
+}
+
+func (s *judgeScorer[T, U]) Score(ctx context.Context, input T, output U) (float64, jpf.Usage, error) {
+	return validators.AskJudge(ctx, s.model, s.encoder, s.parser, input, output)
+}
+
+// Scored is a candidate response and its score.
+type Scored[U any] struct {
+	Result U
+	Score  float64
+}
+
+// BestOfN is the outcome of a best of n pipeline.
+type BestOfN[U any] struct {
+	// The candidate with the highest score.
+	Best Scored[U]
+	// Every valid candidate, from highest to lowest score.
+	Candidates []Scored[U]
+}
+
+// NewBestOfN creates a [Pipeline] that calls the pipeline n times concurrently, scores each valid response with the scorer,
+// and returns the candidate with the highest score along with every scored candidate.
+// Candidates that are invalid, or that the scorer rejects, are discarded, and an invalid response is only returned if no candidate was left.
+// Ties go to the candidate that was sampled first. Usage of both the pipeline and the scorer is summed across all candidates.
+func NewBestOfN[T, U any](pipeline jpf.Pipeline[T, U], scorer Scorer[T, U], n int, opts ...BestOfNOpt) jpf.Pipeline[T, BestOfN[U]] {
+	if n < 1 {
+		panic("NewBestOfN requires at least one candidate")
+	}
+	p := &bestOfNPipeline[T, U]{
+		pipeline:    pipeline,
+		scorer:      scorer,
+		n:           n,
+		concurrency: n,
+	}
+	for _, o := range opts {
+		o(&p.concurrency)
+	}
+	return p
+}
+
+type BestOfNOpt func(concurrency *int)
+
+// Generate and score at most n candidates at the same time. By default, all candidates are run at once.
+func WithBestOfNConcurrency(n int) BestOfNOpt {
+	return func(concurrency *int) { *concurrency = max(n, 1) }
+}
+
+type bestOfNPipeline[T, U any] struct {
+	pipeline    jpf.Pipeline[T, U]
+	scorer      Scorer[T, U]
+	n           int
+	concurrency int
+}
+
+// bestOfNCandidate is a scored candidate, or the reason it was discarded.
+type bestOfNCandidate[U any] struct {
+	scored Scored[U]
+	err    error
+}
+
+func (p *bestOfNPipeline[T, U]) Call(ctx context.Context, input T) (jpf.PipelineResponse[BestOfN[U]], error) {
+	candidates, usage, err := runAll(ctx, slices.Repeat([]T{input}, p.n), p.concurrency, "candidate", p.candidate)
+	if err != nil {
+		return jpf.PipelineResponse[BestOfN[U]]{Usage: usage}, err
+	}
+	scored := make([]Scored[U], 0, p.n)
+	invalidErrs := make([]error, 0)
+	for _, candidate := range candidates {
+		if candidate.err != nil {
+			invalidErrs = append(invalidErrs, candidate.err)
+		} else {
+			scored = append(scored, candidate.scored)
+		}
+	}
+	if len(scored) == 0 {
+		invalidErrs = slices.Insert(invalidErrs, 0, errors.New("no candidates produced a valid response"))
+		return jpf.PipelineResponse[BestOfN[U]]{Usage: usage}, errors.Join(invalidErrs...)
+	}
+	slices.SortStableFunc(scored, func(a, b Scored[U]) int {
+		switch {
+		case a.Score > b.Score:
+			return -1
+		case a.Score < b.Score:
+			return 1
+		}
+		return 0
+	})
+	return jpf.PipelineResponse[BestOfN[U]]{
+		Result: BestOfN[U]{Best: scored[0], Candidates: scored},
+		Usage:  usage,
+	}, nil
+}
+
+// candidate generates and scores a single candidate.
+// Invalid candidates are returned with their error rather than failing, as they are discarded instead of failing the pipeline.
+func (p *bestOfNPipeline[T, U]) candidate(ctx context.Context, input T) (bestOfNCandidate[U], jpf.Usage, error) {
+	resp, err := p.pipeline.Call(ctx, input)
+	if err != nil {
+		return discardInvalid[U](resp.Usage, utils.Wrap(err, "failed to generate candidate"))
+	}
+	score, scoreUsage, err := p.scorer.Score(ctx, input, resp.Result)
+	usage := resp.Usage.Add(scoreUsage)
+	if err != nil {
+		return discardInvalid[U](usage, utils.Wrap(err, "failed to score candidate"))
+	}
+	return bestOfNCandidate[U]{scored: Scored[U]{Result: resp.Result, Score: score}}, usage, nil
+}
+
+func discardInvalid[U any](usage jpf.Usage, err error) (bestOfNCandidate[U], jpf.Usage, error) {
+	if errors.Is(err, jpf.ErrInvalidResponse) {
+		return bestOfNCandidate[U]{err: err}, usage, nil
+	}
+	return bestOfNCandidate[U]{}, usage, err
+}
@@ -0,0 +1,65 @@
+package pipelines
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/encoders"
+	"github.com/JoshPattman/jpf/parsers"
+	"github.com/JoshPattman/jpf/validators"
+)
+
+func TestBestOfN(t *testing.T) {
+	byLength := ScorerFunc[string, string](func(_, out string) float64 { return float64(len(out)) })
+	inner := &sequencePipeline{responses: []string{"cat", "invalid", "horse", "dog"}}
+	resp, err := NewBestOfN(inner, byLength, 4).Call(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Result.Best != (Scored[string]{"horse", 5}) || len(resp.Result.Candidates) != 3 || resp.Result.Candidates[2].Score != 3 {
+		t.Fatalf("expected horse to win out of 3 candidates, got %+v", resp.Result)
+	}
+	if resp.Usage.SuccessfulCalls != 4 {
+		t.Fatalf("expected usage of 4 calls, got %v", resp.Usage)
+	}
+
+	inner = &sequencePipeline{responses: []string{"invalid 1", "invalid 2"}}
+	_, err = NewBestOfN(inner, byLength, 2).Call(context.Background(), "")
+	if !errors.Is(err, jpf.ErrInvalidResponse) {
+		t.Fatalf("expected an invalid response when every candidate is invalid, got %v", err)
+	}
+
+	inner = &sequencePipeline{responses: []string{"cat", "fatal", "dog"}}
+	_, err = NewBestOfN(inner, byLength, 3, WithBestOfNConcurrency(1)).Call(context.Background(), "")
+	if err == nil || errors.Is(err, jpf.ErrInvalidResponse) || inner.calls != 2 {
+		t.Fatalf("expected a fatal error after 2 calls, got %v after %d calls", err, inner.calls)
+	}
+}
+
+func TestBestOfNJudge(t *testing.T) {
+	judge := &recordingModel{responses: []string{"Score: 3", "9", "not a score"}}
+	scorer := NewJudgeScorer(
+		judge,
+		encoders.NewTemplate[validators.JudgeInput[string, string]]("Rate the name from 0 to 10.", "{{.Input}}: {{.Output}}"),
+		parsers.NewJson[float64](),
+	)
+	inner := &sequencePipeline{responses: []string{"Rex", "Sir Barks", "Fido"}}
+	pipeline := NewBestOfN(inner, scorer, 2, WithBestOfNConcurrency(1))
+	resp, err := pipeline.Call(context.Background(), "dog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Result.Best != (Scored[string]{"Sir Barks", 9}) {
+		t.Fatalf("expected Sir Barks to win, got %+v", resp.Result)
+	}
+	if len(judge.calls) != 2 || judge.calls[1][1].(jpf.UserMessage).Content != "dog: Sir Barks" {
+		t.Fatalf("expected the judge to see each candidate, got %v", judge.calls)
+	}
+
+	_, err = NewBestOfN(inner, scorer, 1).Call(context.Background(), "dog")
+	if err == nil || errors.Is(err, jpf.ErrInvalidResponse) {
+		t.Fatalf("expected an invalid score not to be an invalid response, got %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package pipelines
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/internal/utils"
+)
+
+// batchCheckpoint is a json lines file of the successful results of a batch.
+type batchCheckpoint[U any] struct {
+	lock    sync.Mutex
+	file    *os.File
+	entries map[int]batchCheckpointEntry[U]
+}
+
+type batchCheckpointEntry[U any] struct {
+	Index  int       `json:"index"`
+	Input  string    `json:"input"`
+	Result U         `json:"result"`
+	Usage  jpf.Usage `json:"usage"`
+}
+
+// openBatchCheckpoint loads the entries already in the checkpoint file (creating it if needed), and opens it for saving more.
+func openBatchCheckpoint[U any](path string) (*batchCheckpoint[U], error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	entries := make(map[int]batchCheckpointEntry[U])
+	lines := bytes.Split(data, []byte("\n"))
+	// The last line is either empty, or was cut off part way through being written, so is removed.
+	for i, line := range lines[:len(lines)-1] {
+		var entry batchCheckpointEntry[U]
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, utils.Wrap(err, "invalid checkpoint entry on line %d", i+1)
+		}
+		entries[entry.Index] = entry
+	}
+	if partial := lines[len(lines)-1]; len(partial) > 0 {
+		if err := os.Truncate(path, int64(len(data)-len(partial))); err != nil {
+			return nil, err
+		}
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &batchCheckpoint[U]{file: file, entries: entries}, nil
+}
+
+// Lookup returns the saved result of the input at the index, if there is one.
+// It is an error for the saved result to be for a different input.
+func (c *batchCheckpoint[U]) Lookup(index int, hash string) (BatchResult[U], bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry, ok := c.entries[index]
+	if !ok {
+		return BatchResult[U]{}, false, nil
+	}
+	if entry.Input != hash {
+		return BatchResult[U]{}, false, fmt.Errorf("input %d has changed since the checkpoint was written", index)
+	}
+	return BatchResult[U]{Index: index, Result: entry.Result, Usage: entry.Usage, Resumed: true}, true, nil
+}
+
+// Save appends a successful result to the checkpoint file.
+func (c *batchCheckpoint[U]) Save(hash string, result BatchResult[U]) error {
+	entry := batchCheckpointEntry[U]{Index: result.Index, Input: hash, Result: result.Result, Usage: result.Usage}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, err := c.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	c.entries[entry.Index] = entry
+	return nil
+}
+
+func (c *batchCheckpoint[U]) Close() error {
+	return c.file.Close()
+}
+
+// hashBatchInput identifies an input by the hash of its json, so that a checkpoint can tell if the inputs have changed.
+func hashBatchInput[T any](input T) (string, error) {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]), nil
+}
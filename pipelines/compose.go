@@ -0,0 +1,143 @@
+package pipelines
+
+import (
+	"context"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/internal/utils"
+)
+
+// Chain creates a [Pipeline] that passes the result of the first pipeline to the second, summing the usage of both.
+// Chains of more than two steps can be made by nesting, for example Chain(extract, Chain(classify, summarise)).
+func Chain[T, V, U any](first jpf.Pipeline[T, V], second jpf.Pipeline[V, U]) jpf.Pipeline[T, U] {
+	return &chainPipeline[T, V, U]{first: first, second: second}
+}
+
+type chainPipeline[T, V, U any] struct {
+	first  jpf.Pipeline[T, V]
+	second jpf.Pipeline[V, U]
+}
+
+func (p *chainPipeline[T, V, U]) Call(ctx context.Context, input T) (jpf.PipelineResponse[U], error) {
+	firstResp, err := p.first.Call(ctx, input)
+	if err != nil {
+		return jpf.PipelineResponse[U]{Usage: firstResp.Usage}, utils.Wrap(err, "failed to run first pipeline of chain")
+	}
+	secondResp, err := p.second.Call(ctx, firstResp.Result)
+	usage := firstResp.Usage.Add(secondResp.Usage)
+	if err != nil {
+		return jpf.PipelineResponse[U]{Usage: usage}, utils.Wrap(err, "failed to run second pipeline of chain")
+	}
+	return jpf.PipelineResponse[U]{Result: secondResp.Result, Usage: usage}, nil
+}
+
+// ParallelBranch is one of the pipelines run by [Parallel], along with where its result goes in the gathered struct.
+// Create one with [Into].
+type ParallelBranch[T, U any] struct {
+	call func(context.Context, T) (func(*U), jpf.Usage, error)
+}
+
+// Into creates a [ParallelBranch] that runs the pipeline, and stores its result in the gathered struct with the set function.
+func Into[T, U, V any](pipeline jpf.Pipeline[T, V], set func(*U, V)) ParallelBranch[T, U] {
+	return ParallelBranch[T, U]{
+		call: func(ctx context.Context, input T) (func(*U), jpf.Usage, error) {
+			resp, err := pipeline.Call(ctx, input)
+			if err != nil {
+				return nil, resp.Usage, err
+			}
+			return func(u *U) { set(u, resp.Result) }, resp.Usage, nil
+		},
+	}
+}
+
+// Parallel creates a [Pipeline] that runs every branch on the same input concurrently, gathering their results into a struct,
+// and summing the usage of every branch. For example:
+//
+//	Parallel(
+//		Into(classify, func(r *Report, c Category) { r.Category = c }),
+//		Into(summarise, func(r *Report, s string) { r.Summary = s }),
+//	)
+//
+// If any branches are invalid, the error lists which branches failed and why. Any other error cancels the remaining branches.
+func Parallel[T, U any](branches ...ParallelBranch[T, U]) jpf.Pipeline[T, U] {
+	return &parallelPipeline[T, U]{branches: branches}
+}
+
+type parallelPipeline[T, U any] struct {
+	branches []ParallelBranch[T, U]
+}
+
+func (p *parallelPipeline[T, U]) Call(ctx context.Context, input T) (jpf.PipelineResponse[U], error) {
+	setters, usage, err := runAll(ctx, p.branches, len(p.branches), "branch", func(ctx context.Context, branch ParallelBranch[T, U]) (func(*U), jpf.Usage, error) {
+		return branch.call(ctx, input)
+	})
+	if err != nil {
+		return jpf.PipelineResponse[U]{Usage: usage}, utils.Wrap(err, "failed to run parallel branches")
+	}
+	// Results are only set once every branch is done, so the struct is never written concurrently.
+	var result U
+	for _, set := range setters {
+		set(&result)
+	}
+	return jpf.PipelineResponse[U]{Result: result, Usage: usage}, nil
+}
+
+// Branch creates a [Pipeline] that runs ifTrue when the predicate is true for the input, and ifFalse otherwise.
+func Branch[T, U any](predicate func(T) bool, ifTrue, ifFalse jpf.Pipeline[T, U]) jpf.Pipeline[T, U] {
+	return &branchPipeline[T, U]{predicate: predicate, ifTrue: ifTrue, ifFalse: ifFalse}
+}
+
+type branchPipeline[T, U any] struct {
+	predicate func(T) bool
+	ifTrue    jpf.Pipeline[T, U]
+	ifFalse   jpf.Pipeline[T, U]
+}
+
+func (p *branchPipeline[T, U]) Call(ctx context.Context, input T) (jpf.PipelineResponse[U], error) {
+	if p.predicate(input) {
+		return p.ifTrue.Call(ctx, input)
+	}
+	return p.ifFalse.Call(ctx, input)
+}
+
+// MapInput creates a [Pipeline] that transforms its input with the function before passing it to the pipeline.
+// Errors from the function are returned unchanged.
+func MapInput[T, V, U any](pipeline jpf.Pipeline[V, U], transform func(T) (V, error)) jpf.Pipeline[T, U] {
+	return &mapInputPipeline[T, V, U]{pipeline: pipeline, transform: transform}
+}
+
+type mapInputPipeline[T, V, U any] struct {
+	pipeline  jpf.Pipeline[V, U]
+	transform func(T) (V, error)
+}
+
+func (p *mapInputPipeline[T, V, U]) Call(ctx context.Context, input T) (jpf.PipelineResponse[U], error) {
+	mapped, err := p.transform(input)
+	if err != nil {
+		return jpf.PipelineResponse[U]{}, err
+	}
+	return p.pipeline.Call(ctx, mapped)
+}
+
+// MapOutput creates a [Pipeline] that transforms the result of the pipeline with the function.
+// Errors from the function are returned unchanged, along with the usage of the pipeline.
+func MapOutput[T, U, V any](pipeline jpf.Pipeline[T, U], transform func(U) (V, error)) jpf.Pipeline[T, V] {
+	return &mapOutputPipeline[T, U, V]{pipeline: pipeline, transform: transform}
+}
+
+type mapOutputPipeline[T, U, V any] struct {
+	pipeline  jpf.Pipeline[T, U]
+	transform func(U) (V, error)
+}
+
+func (p *mapOutputPipeline[T, U, V]) Call(ctx context.Context, input T) (jpf.PipelineResponse[V], error) {
+	resp, err := p.pipeline.Call(ctx, input)
+	if err != nil {
+		return jpf.PipelineResponse[V]{Usage: resp.Usage}, err
+	}
+	result, err := p.transform(resp.Result)
+	if err != nil {
+		return jpf.PipelineResponse[V]{Usage: resp.Usage}, err
+	}
+	return jpf.PipelineResponse[V]{Result: result, Usage: resp.Usage}, nil
+}
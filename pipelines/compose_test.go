@@ -0,0 +1,124 @@
+package pipelines
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/JoshPattman/jpf"
+)
+
+func TestCompose(t *testing.T) {
+	length := pipelineFunc[string, int](func(_ context.Context, s string) (jpf.PipelineResponse[int], error) {
+		return jpf.PipelineResponse[int]{Result: len(s), Usage: jpf.Usage{SuccessfulCalls: 1}}, nil
+	})
+	double := pipelineFunc[int, int](func(_ context.Context, n int) (jpf.PipelineResponse[int], error) {
+		return jpf.PipelineResponse[int]{Result: n * 2, Usage: jpf.Usage{SuccessfulCalls: 1}}, nil
+	})
+	upper := pipelineFunc[string, string](func(_ context.Context, s string) (jpf.PipelineResponse[string], error) {
+		return jpf.PipelineResponse[string]{Result: strings.ToUpper(s), Usage: jpf.Usage{SuccessfulCalls: 1}}, nil
+	})
+	invalid := pipelineFunc[string, string](func(context.Context, string) (jpf.PipelineResponse[string], error) {
+		return jpf.PipelineResponse[string]{Usage: jpf.Usage{SuccessfulCalls: 1}}, errors.Join(errors.New("bad response"), jpf.ErrInvalidResponse)
+	})
+
+	type report struct {
+		Length int
+		Upper  string
+	}
+	cases := []struct {
+		name          string
+		pipeline      jpf.Pipeline[string, string]
+		input         string
+		expected      string
+		expectedCalls int
+		expectedErr   string
+	}{
+		{
+			name:          "chain",
+			pipeline:      MapOutput(Chain(length, double), func(n int) (string, error) { return strconv.Itoa(n), nil }),
+			input:         "abc",
+			expected:      "6",
+			expectedCalls: 2,
+		},
+		{
+			name:          "chain stops at error",
+			pipeline:      Chain(invalid, upper),
+			expectedCalls: 1,
+			expectedErr:   "failed to run first pipeline of chain",
+		},
+		{
+			name: "parallel",
+			pipeline: MapOutput(
+				Parallel(
+					Into(length, func(r *report, n int) { r.Length = n }),
+					Into(upper, func(r *report, s string) { r.Upper = s }),
+				),
+				func(r report) (string, error) { return r.Upper + strconv.Itoa(r.Length), nil },
+			),
+			input:         "abc",
+			expected:      "ABC3",
+			expectedCalls: 2,
+		},
+		{
+			name:          "parallel invalid",
+			pipeline:      Parallel(Into(upper, func(s *string, v string) { *s = v }), Into(invalid, func(s *string, v string) { *s = v })),
+			expectedCalls: 2,
+			expectedErr:   "1 of 2 were invalid\nbranch 2: bad response",
+		},
+		{
+			name:          "branch true",
+			pipeline:      Branch(func(s string) bool { return strings.HasPrefix(s, "x") }, upper, invalid),
+			input:         "xyz",
+			expected:      "XYZ",
+			expectedCalls: 1,
+		},
+		{
+			name:          "branch false",
+			pipeline:      Branch(func(s string) bool { return strings.HasPrefix(s, "x") }, upper, invalid),
+			input:         "abc",
+			expectedCalls: 1,
+			expectedErr:   "bad response",
+		},
+		{
+			name:          "map input",
+			pipeline:      MapInput(upper, func(s string) (string, error) { return strings.TrimSpace(s), nil }),
+			input:         "  abc ",
+			expected:      "ABC",
+			expectedCalls: 1,
+		},
+		{
+			name:        "map input error",
+			pipeline:    MapInput(upper, func(s string) (string, error) { return "", errors.New("cannot map") }),
+			expectedErr: "cannot map",
+		},
+		{
+			name:          "map output error keeps usage",
+			pipeline:      MapOutput(upper, func(s string) (string, error) { return "", errors.New("cannot map") }),
+			expectedCalls: 1,
+			expectedErr:   "cannot map",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resp, err := c.pipeline.Call(context.Background(), c.input)
+			if resp.Usage.SuccessfulCalls != c.expectedCalls {
+				t.Fatalf("expected usage of %d calls but got %v", c.expectedCalls, resp.Usage)
+			}
+			if c.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.expectedErr) {
+					t.Fatalf("expected an error containing %q but got %v", c.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Result != c.expected {
+				t.Fatalf("expected %q but got %q", c.expected, resp.Result)
+			}
+		})
+	}
+}
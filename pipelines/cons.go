@@ -5,8 +5,12 @@ import "github.com/JoshPattman/jpf"
 type ConstructionOpt[T, U any] func(*ConstructionKwargs[T, U])
 
 type ConstructionKwargs[T, U any] struct {
-	OutputFormat any
-	Validator    jpf.Validator[T, U]
+	OutputFormat    any
+	Validator       jpf.Validator[T, U]
+	Streamer        jpf.ModelStreamer
+	NewStreamer     func() jpf.ModelStreamer
+	FeedbackRole    jpf.Role
+	HistoryStrategy HistoryStrategy
 }
 
 func GetConstructionKwargs[T, U any](opts ...ConstructionOpt[T, U]) ConstructionKwargs[T, U] {
@@ -32,3 +36,58 @@ func WithValidator[T, U any](validator jpf.Validator[T, U]) ConstructionOpt[T, U
 		ck.Validator = validator
 	}
 }
+
+// Stream each model response made by the pipeline to the streamer.
+// When the pipeline retries, the streamer will receive a new message begin.
+func WithStreamer[T, U any](streamer jpf.ModelStreamer) ConstructionOpt[T, U] {
+	return func(ck *ConstructionKwargs[T, U]) {
+		ck.Streamer = streamer
+	}
+}
+
+// Stream each model response made by the pipeline to a streamer created for that call of the pipeline.
+// Use this instead of [WithStreamer] when the streamer holds the state of a single response (such as parsers.NewStreamingJson)
+// and the pipeline may be called concurrently.
+func WithStreamerFactory[T, U any](newStreamer func() jpf.ModelStreamer) ConstructionOpt[T, U] {
+	return func(ck *ConstructionKwargs[T, U]) {
+		ck.NewStreamer = newStreamer
+	}
+}
+
+// streamerFactory returns the function that gives the streamer for each call of a pipeline.
+func (ck ConstructionKwargs[T, U]) streamerFactory() func() jpf.ModelStreamer {
+	if ck.NewStreamer != nil {
+		return ck.NewStreamer
+	}
+	streamer := ck.Streamer
+	return func() jpf.ModelStreamer { return streamer }
+}
+
+// Send feedback to the model as a message with the role, instead of as a user message.
+// Only used by pipelines that give feedback.
+func WithFeedbackRole[T, U any](role jpf.Role) ConstructionOpt[T, U] {
+	return func(ck *ConstructionKwargs[T, U]) {
+		ck.FeedbackRole = role
+	}
+}
+
+// HistoryStrategy decides which failed attempts are kept in the conversation when a pipeline retries with feedback.
+type HistoryStrategy uint8
+
+const (
+	// Keep every failed response and its feedback, so the model can see all of its mistakes.
+	KeepAllAttempts HistoryStrategy = iota
+	// Keep only the latest failed response and its feedback, so the conversation does not grow with each retry.
+	KeepLatestAttempt
+	// Restart from the original messages each time, with the latest feedback folded in (the failed response itself is not sent).
+	// This is the cheapest, but the model cannot see its previous response.
+	RestartWithFeedback
+)
+
+// Choose which failed attempts are kept in the conversation when retrying, which defaults to [KeepAllAttempts].
+// Only used by pipelines that give feedback.
+func WithHistoryStrategy[T, U any](strategy HistoryStrategy) ConstructionOpt[T, U] {
+	return func(ck *ConstructionKwargs[T, U]) {
+		ck.HistoryStrategy = strategy
+	}
+}
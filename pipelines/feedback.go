@@ -3,6 +3,7 @@ package pipelines
 import (
 	"context"
 	"errors"
+	"slices"
 
 	"github.com/JoshPattman/jpf"
 	"github.com/JoshPattman/jpf/internal/utils"
@@ -11,6 +12,7 @@ import (
 // NewFeedbackRetry creates a [Pipeline] that first runs the encoder, then the model, finally parsing the response with the decoder.
 // However, it adds feedback to the conversation when errors are detected.
 // It will only add to the conversation if the error returned from the parser is an [ErrInvalidResponse] (using errors.Is).
+// The role of the feedback messages can be set with [WithFeedbackRole], and how many failed attempts are kept with [WithHistoryStrategy].
 func NewFeedbackRetry[T, U any](
 	encoder jpf.Encoder[T],
 	parser jpf.Parser[U],
@@ -28,6 +30,9 @@ func NewFeedbackRetry[T, U any](
 		model:             model,
 		maxRetries:        maxRetries,
 		outputFormat:      kwargs.OutputFormat,
+		newStreamer:       kwargs.streamerFactory(),
+		feedbackRole:      kwargs.FeedbackRole,
+		historyStrategy:   kwargs.HistoryStrategy,
 	}
 }
 
@@ -39,37 +44,42 @@ type feedbackPipeline[T, U any] struct {
 	model             jpf.Model
 	maxRetries        int
 	outputFormat      any
+	newStreamer       func() jpf.ModelStreamer
+	feedbackRole      jpf.Role
+	historyStrategy   HistoryStrategy
 }
 
 func (mf *feedbackPipeline[T, U]) Call(ctx context.Context, t T) (jpf.PipelineResponse[U], error) {
-	history, err := mf.encoder.BuildInputMessages(t)
+	original, err := mf.encoder.BuildInputMessages(t)
 	if err != nil {
 		return jpf.PipelineResponse[U]{}, utils.Wrap(err, "failed to build input messages")
 	}
+	history := original
+	streamer := mf.newStreamer()
 	totalUsage := jpf.Usage{}
 	var lastErr error
-	for range mf.maxRetries + 1 {
-		resp, err := mf.model.Respond(ctx, history, jpf.WithOutputFormat(mf.outputFormat))
+	for attempt := range mf.maxRetries + 1 {
+		resp, err := mf.model.Respond(ctx, history, jpf.WithOutputFormat(mf.outputFormat), jpf.WithStreamResponse(streamer))
 		totalUsage = totalUsage.Add(resp.Usage)
 		if err != nil {
 			return jpf.PipelineResponse[U]{Usage: totalUsage}, utils.Wrap(err, "failed to get model response")
 		}
-		result, err := mf.parser.ParseResponseText(resp.Message.Content)
-		// If there was no parse error and we have a validator, validate
-		if err == nil && mf.validator != nil {
-			err = mf.validator.ValidateParsedResponse(t, result)
+		result, parseUsage, err := parse(ctx, mf.parser, resp.Message.Content)
+		totalUsage = totalUsage.Add(parseUsage)
+		// If there was no parse error, validate
+		if err == nil {
+			var validateUsage jpf.Usage
+			validateUsage, err = validate(ctx, mf.validator, t, result)
+			totalUsage = totalUsage.Add(validateUsage)
 		}
 		if err == nil {
 			// If the result was ok, return it
 			return jpf.PipelineResponse[U]{Result: result, Usage: totalUsage}, nil
 		} else if errors.Is(err, jpf.ErrInvalidResponse) {
 			// If it was a parse error, add to the conversation history and continue looping
-			feedback := mf.feedbackGenerator.FormatFeedback(resp.Message, err)
+			feedback := formatFeedback(mf.feedbackGenerator, resp.Message, err, attempt+1)
 			lastErr = err
-			history = append(history, resp.Message)
-			history = append(history, jpf.UserMessage{
-				Content: feedback,
-			})
+			history = mf.nextHistory(original, history, resp.Message, feedback)
 		} else {
 			// Otherwise, it was another error so return the error (don't loop)
 			return jpf.PipelineResponse[U]{Usage: totalUsage}, utils.Wrap(err, "failed to parse model response")
@@ -77,3 +87,23 @@ func (mf *feedbackPipeline[T, U]) Call(ctx context.Context, t T) (jpf.PipelineRe
 	}
 	return jpf.PipelineResponse[U]{Usage: totalUsage}, utils.Wrap(lastErr, "model failed to produce a valid response after trying %d times", mf.maxRetries+1)
 }
+
+// nextHistory builds the conversation for the next attempt, following the history strategy.
+func (mf *feedbackPipeline[T, U]) nextHistory(original, history []jpf.Message, failed jpf.AssistantMessage, feedback string) []jpf.Message {
+	switch mf.historyStrategy {
+	case KeepLatestAttempt:
+		return append(slices.Clone(original), failed, mf.feedbackRole.Message(feedback))
+	case RestartWithFeedback:
+		next := slices.Clone(original)
+		if len(next) > 0 && mf.feedbackRole == jpf.UserRole {
+			if last, ok := next[len(next)-1].(jpf.UserMessage); ok {
+				last.Content += "\n\n" + feedback
+				next[len(next)-1] = last
+				return next
+			}
+		}
+		return append(next, mf.feedbackRole.Message(feedback))
+	default:
+		return append(history, failed, mf.feedbackRole.Message(feedback))
+	}
+}
@@ -0,0 +1,107 @@
+package pipelines
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/internal/utils"
+)
+
+// NewMapReduce creates a [Pipeline] for inputs that are too large to process in one call, such as summarising a long document.
+// The splitter splits the input into chunks, the mapper is called on every chunk concurrently,
+// and the reducer combines the results of all chunks into the final output.
+// Use [WithTreeReduction] if there may be too many chunk results for the reducer to see at once.
+// If any chunks are invalid, the error lists which chunks failed and why. Usage is summed across every call.
+func NewMapReduce[T, C, U any](
+	splitter Splitter[T],
+	mapper jpf.Pipeline[T, C],
+	reducer jpf.Pipeline[[]C, U],
+	opts ...MapReduceOpt[C, U],
+) jpf.Pipeline[T, U] {
+	p := &mapReducePipeline[T, C, U]{
+		splitter: splitter,
+		mapper:   mapper,
+		reducer:  reducer,
+		settings: mapReduceSettings[C, U]{concurrency: 4},
+	}
+	for _, o := range opts {
+		o(&p.settings)
+	}
+	return p
+}
+
+type MapReduceOpt[C, U any] func(*mapReduceSettings[C, U])
+
+type mapReduceSettings[C, U any] struct {
+	concurrency int
+	fanIn       int
+	asChunk     func(U) C
+}
+
+// Run at most n map or reduce calls at the same time, which defaults to 4.
+func WithMapReduceConcurrency[C, U any](n int) MapReduceOpt[C, U] {
+	return func(s *mapReduceSettings[C, U]) { s.concurrency = max(n, 1) }
+}
+
+// Reduce at most fanIn results per call, by reducing groups of results and then reducing the reduced results, until they fit in one call.
+// asChunk converts an intermediate reduced output back into a chunk result (for summaries, where C and U are both strings, this is just the identity).
+func WithTreeReduction[C, U any](fanIn int, asChunk func(U) C) MapReduceOpt[C, U] {
+	if fanIn < 2 {
+		panic("WithTreeReduction requires a fan in of at least 2")
+	}
+	return func(s *mapReduceSettings[C, U]) {
+		s.fanIn = fanIn
+		s.asChunk = asChunk
+	}
+}
+
+type mapReducePipeline[T, C, U any] struct {
+	splitter Splitter[T]
+	mapper   jpf.Pipeline[T, C]
+	reducer  jpf.Pipeline[[]C, U]
+	settings mapReduceSettings[C, U]
+}
+
+func (p *mapReducePipeline[T, C, U]) Call(ctx context.Context, input T) (jpf.PipelineResponse[U], error) {
+	chunks, err := p.splitter.Split(input)
+	if err != nil {
+		return jpf.PipelineResponse[U]{}, utils.Wrap(err, "failed to split input")
+	}
+	if len(chunks) == 0 {
+		return jpf.PipelineResponse[U]{}, errors.New("input was split into no chunks")
+	}
+	results, usage, err := runAll(ctx, chunks, p.settings.concurrency, "chunk", func(ctx context.Context, chunk T) (C, jpf.Usage, error) {
+		resp, err := p.mapper.Call(ctx, chunk)
+		return resp.Result, resp.Usage, err
+	})
+	if err != nil {
+		return jpf.PipelineResponse[U]{Usage: usage}, utils.Wrap(err, "failed to map chunks")
+	}
+	for p.settings.fanIn > 0 && len(results) > p.settings.fanIn {
+		groups := make([][]C, 0, (len(results)+p.settings.fanIn-1)/p.settings.fanIn)
+		for group := range slices.Chunk(results, p.settings.fanIn) {
+			groups = append(groups, group)
+		}
+		var groupUsage jpf.Usage
+		results, groupUsage, err = runAll(ctx, groups, p.settings.concurrency, "group", func(ctx context.Context, group []C) (C, jpf.Usage, error) {
+			resp, err := p.reducer.Call(ctx, group)
+			if err != nil {
+				var zero C
+				return zero, resp.Usage, err
+			}
+			return p.settings.asChunk(resp.Result), resp.Usage, nil
+		})
+		usage = usage.Add(groupUsage)
+		if err != nil {
+			return jpf.PipelineResponse[U]{Usage: usage}, utils.Wrap(err, "failed to reduce groups of results")
+		}
+	}
+	resp, err := p.reducer.Call(ctx, results)
+	usage = usage.Add(resp.Usage)
+	if err != nil {
+		return jpf.PipelineResponse[U]{Usage: usage}, utils.Wrap(err, "failed to reduce results")
+	}
+	return jpf.PipelineResponse[U]{Result: resp.Result, Usage: usage}, nil
+}
@@ -0,0 +1,109 @@
+package pipelines
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/JoshPattman/jpf"
+)
+
+// pipelineFunc is a pipeline that calls the function.
+type pipelineFunc[T, U any] func(context.Context, T) (jpf.PipelineResponse[U], error)
+
+func (f pipelineFunc[T, U]) Call(ctx context.Context, input T) (jpf.PipelineResponse[U], error) {
+	return f(ctx, input)
+}
+
+func TestSplitters(t *testing.T) {
+	cases := []struct {
+		name     string
+		splitter Splitter[string]
+		input    string
+		expected []string
+	}{
+		{
+			name:     "paragraphs packed",
+			splitter: SplitParagraphs(12),
+			input:    "one\n\ntwo\n  \nthree\n\nfour",
+			expected: []string{"one\n\ntwo", "three\n\nfour"},
+		},
+		{
+			name:     "long paragraph split by words",
+			splitter: SplitParagraphs(10),
+			input:    "short\n\nthis paragraph is too long",
+			expected: []string{"short", "this", "paragraph", "is too", "long"},
+		},
+		{
+			name:     "tokens",
+			splitter: SplitTokens(3, func(s string) int { return len(strings.TrimSpace(s)) / 2 }),
+			input:    "aa bb cc\ndddd ee",
+			expected: []string{"aa bb cc", "dddd ee"},
+		},
+		{
+			name:     "estimated tokens",
+			splitter: SplitTokens(2, nil),
+			input:    "abcd abcd abcd",
+			expected: []string{"abcd", "abcd", "abcd"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			chunks, err := c.splitter.Split(c.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(chunks, c.expected) {
+				t.Fatalf("expected %q but got %q", c.expected, chunks)
+			}
+		})
+	}
+}
+
+func TestMapReduce(t *testing.T) {
+	var reduceCalls atomic.Int32
+	mapper := pipelineFunc[string, string](func(_ context.Context, chunk string) (jpf.PipelineResponse[string], error) {
+		usage := jpf.Usage{SuccessfulCalls: 1}
+		if chunk == "c" || chunk == "e" {
+			return jpf.PipelineResponse[string]{Usage: usage}, errors.Join(errors.New("cannot map "+chunk), jpf.ErrInvalidResponse)
+		}
+		return jpf.PipelineResponse[string]{Result: strings.ToUpper(chunk), Usage: usage}, nil
+	})
+	reducer := pipelineFunc[[]string, string](func(_ context.Context, results []string) (jpf.PipelineResponse[string], error) {
+		reduceCalls.Add(1)
+		return jpf.PipelineResponse[string]{Result: strings.Join(results, ""), Usage: jpf.Usage{SuccessfulCalls: 1}}, nil
+	})
+	words := SplitterFunc[string](func(s string) ([]string, error) { return strings.Fields(s), nil })
+	identity := func(s string) string { return s }
+
+	pipeline := NewMapReduce(words, mapper, reducer, WithTreeReduction(3, identity), WithMapReduceConcurrency[string, string](2))
+	resp, err := pipeline.Call(context.Background(), "a b d f g h i")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Result != "ABDFGHI" || reduceCalls.Load() != 4 || resp.Usage.SuccessfulCalls != 11 {
+		t.Fatalf("expected ABDFGHI from 4 reduce calls and 11 calls in total, got %q from %d reduce calls (%v)", resp.Result, reduceCalls.Load(), resp.Usage)
+	}
+
+	reduceCalls.Store(0)
+	resp, err = NewMapReduce(words, mapper, reducer).Call(context.Background(), "a b d")
+	if err != nil || resp.Result != "ABD" || reduceCalls.Load() != 1 {
+		t.Fatalf("expected ABD from a single reduce call, got %q from %d reduce calls (%v)", resp.Result, reduceCalls.Load(), err)
+	}
+
+	resp, err = pipeline.Call(context.Background(), "a b c d e f g")
+	if !errors.Is(err, jpf.ErrInvalidResponse) {
+		t.Fatalf("expected an invalid response, got %v", err)
+	}
+	for _, expected := range []string{"2 of 7 were invalid", "chunk 3: cannot map c", "chunk 5: cannot map e"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected the error to contain %q, got %v", expected, err)
+		}
+	}
+	if resp.Usage.SuccessfulCalls != 7 {
+		t.Fatalf("expected the usage of every chunk, got %v", resp.Usage)
+	}
+}
@@ -26,6 +26,7 @@ func NewFallbackRetry[T, U any](
 		kwargs.Validator,
 		models,
 		kwargs.OutputFormat,
+		kwargs.streamerFactory(),
 	}
 }
 
@@ -35,13 +36,15 @@ type fallbackPipeline[T, U any] struct {
 	validator    jpf.Validator[T, U]
 	models       []jpf.Model
 	outputFormat any
+	newStreamer  func() jpf.ModelStreamer
 }
 
 func (m *fallbackPipeline[T, U]) Call(ctx context.Context, input T) (jpf.PipelineResponse[U], error) {
 	totalUsage := jpf.Usage{}
 	errs := make([]error, 0)
+	streamer := m.newStreamer()
 	for _, model := range m.models {
-		result, usage, err := m.callOne(ctx, input, model)
+		result, usage, err := m.callOne(ctx, input, model, streamer)
 		totalUsage = totalUsage.Add(usage)
 		if err == nil {
 			return jpf.PipelineResponse[U]{Result: result, Usage: totalUsage}, nil
@@ -55,25 +58,25 @@ func (m *fallbackPipeline[T, U]) Call(ctx context.Context, input T) (jpf.Pipelin
 	return jpf.PipelineResponse[U]{Usage: totalUsage}, errors.Join(errs...)
 }
 
-func (mf *fallbackPipeline[T, U]) callOne(ctx context.Context, t T, model jpf.Model) (U, jpf.Usage, error) {
+func (mf *fallbackPipeline[T, U]) callOne(ctx context.Context, t T, model jpf.Model, streamer jpf.ModelStreamer) (U, jpf.Usage, error) {
 	var zero U
 	msgs, err := mf.encoder.BuildInputMessages(t)
 	if err != nil {
 		return zero, jpf.Usage{}, utils.Wrap(err, "failed to build input messages")
 	}
-	resp, err := model.Respond(ctx, msgs, jpf.WithOutputFormat(mf.outputFormat))
+	resp, err := model.Respond(ctx, msgs, jpf.WithOutputFormat(mf.outputFormat), jpf.WithStreamResponse(streamer))
 	if err != nil {
 		return zero, resp.Usage, utils.Wrap(err, "failed to get model response")
 	}
-	result, err := mf.decoder.ParseResponseText(resp.Message.Content)
+	result, parseUsage, err := parse(ctx, mf.decoder, resp.Message.Content)
+	usage := resp.Usage.Add(parseUsage)
 	if err != nil {
-		return zero, resp.Usage, utils.Wrap(err, "failed to parse model response")
+		return zero, usage, utils.Wrap(err, "failed to parse model response")
 	}
-	if mf.validator != nil {
-		err = mf.validator.ValidateParsedResponse(t, result)
-		if err != nil {
-			return zero, resp.Usage, utils.Wrap(err, "failed to validate model response")
-		}
+	validateUsage, err := validate(ctx, mf.validator, t, result)
+	usage = usage.Add(validateUsage)
+	if err != nil {
+		return zero, usage, utils.Wrap(err, "failed to validate model response")
 	}
-	return result, resp.Usage, nil
+	return result, usage, nil
 }
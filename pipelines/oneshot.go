@@ -22,6 +22,7 @@ func NewOneShot[T, U any](
 		validator:    kwargs.Validator,
 		model:        model,
 		outputFormat: kwargs.OutputFormat,
+		newStreamer:  kwargs.streamerFactory(),
 	}
 }
 
@@ -31,6 +32,7 @@ type oneShotPipeline[T, U any] struct {
 	validator    jpf.Validator[T, U]
 	model        jpf.Model
 	outputFormat any
+	newStreamer  func() jpf.ModelStreamer
 }
 
 func (mf *oneShotPipeline[T, U]) Call(ctx context.Context, t T) (jpf.PipelineResponse[U], error) {
@@ -38,19 +40,19 @@ func (mf *oneShotPipeline[T, U]) Call(ctx context.Context, t T) (jpf.PipelineRes
 	if err != nil {
 		return jpf.PipelineResponse[U]{}, utils.Wrap(err, "failed to build input messages")
 	}
-	resp, err := mf.model.Respond(ctx, msgs, jpf.WithOutputFormat(mf.outputFormat))
+	resp, err := mf.model.Respond(ctx, msgs, jpf.WithOutputFormat(mf.outputFormat), jpf.WithStreamResponse(mf.newStreamer()))
 	if err != nil {
 		return jpf.PipelineResponse[U]{Usage: resp.Usage}, utils.Wrap(err, "failed to get model response")
 	}
-	result, err := mf.parser.ParseResponseText(resp.Message.Content)
+	result, parseUsage, err := parse(ctx, mf.parser, resp.Message.Content)
+	usage := resp.Usage.Add(parseUsage)
 	if err != nil {
-		return jpf.PipelineResponse[U]{Usage: resp.Usage}, utils.Wrap(err, "failed to parse model response")
+		return jpf.PipelineResponse[U]{Usage: usage}, utils.Wrap(err, "failed to parse model response")
 	}
-	if mf.validator != nil {
-		err := mf.validator.ValidateParsedResponse(t, result)
-		if err != nil {
-			return jpf.PipelineResponse[U]{Usage: resp.Usage}, utils.Wrap(err, "failed to validate model response")
-		}
+	validateUsage, err := validate(ctx, mf.validator, t, result)
+	usage = usage.Add(validateUsage)
+	if err != nil {
+		return jpf.PipelineResponse[U]{Usage: usage}, utils.Wrap(err, "failed to validate model response")
 	}
-	return jpf.PipelineResponse[U]{Result: result, Usage: resp.Usage}, nil
+	return jpf.PipelineResponse[U]{Result: result, Usage: usage}, nil
 }
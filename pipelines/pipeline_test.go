@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"testing"
 
 	"github.com/JoshPattman/jpf"
@@ -19,6 +20,25 @@ func (*alwaysFailValidator[T, U]) ValidateParsedResponse(T, U) error {
 	return errors.Join(errors.New("expected fail"), jpf.ErrInvalidResponse)
 }
 
+// usageValidator rejects the first nFails responses, reporting one call of usage each time it is used.
+type usageValidator struct {
+	nFails int
+}
+
+func (v *usageValidator) ValidateParsedResponse(in, out string) error {
+	_, err := v.ValidateParsedResponseContext(context.Background(), in, out)
+	return err
+}
+
+func (v *usageValidator) ValidateParsedResponseContext(ctx context.Context, _, _ string) (jpf.Usage, error) {
+	usage := jpf.Usage{InputTokens: 3, SuccessfulCalls: 1}
+	if v.nFails > 0 {
+		v.nFails--
+		return usage, errors.Join(errors.New("try again"), jpf.ErrInvalidResponse)
+	}
+	return usage, nil
+}
+
 type MFCase[T any, U comparable] struct {
 	ID            string
 	Build         func() jpf.Pipeline[T, U]
@@ -160,3 +180,196 @@ var MFCases = []utils.TestCase{
 func TestPipeline(t *testing.T) {
 	utils.RunTests(t, MFCases)
 }
+
+func TestPipelineStreamer(t *testing.T) {
+	partials := 0
+	parser := parsers.NewStreamingJson(func(utils.TestStruct) { partials++ })
+	model := &utils.TestingModel{Responses: map[string][]string{
+		"ping": {`{"a":5, "b": "x"}`},
+	}}
+	pipeline := NewOneShot(encoders.NewFixed(""), parser, model, WithStreamer[string, utils.TestStruct](parser))
+	resp, err := pipeline.Call(context.Background(), "ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Result != (utils.TestStruct{A: 5, B: "x"}) {
+		t.Fatalf("unexpected result %v", resp.Result)
+	}
+	if partials == 0 {
+		t.Fatal("expected the streamer to receive the response")
+	}
+}
+
+func TestPipelineStreamerFactory(t *testing.T) {
+	streamers := 0
+	var partials []utils.TestStruct
+	newStreamer := func() jpf.ModelStreamer {
+		streamers++
+		return parsers.NewStreamingJson(func(p utils.TestStruct) { partials = append(partials, p) })
+	}
+	model := &utils.TestingModel{Responses: map[string][]string{
+		"ping": {`{"a":1}`, `{"a":2}`},
+	}}
+	pipeline := NewOneShot(encoders.NewFixed(""), parsers.NewJson[utils.TestStruct](), model, WithStreamerFactory[string, utils.TestStruct](newStreamer))
+	for range 2 {
+		if _, err := pipeline.Call(context.Background(), "ping"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if streamers != 2 {
+		t.Fatalf("expected a streamer to be created for each call, got %d", streamers)
+	}
+	if len(partials) != 2 || partials[0].A != 1 || partials[1].A != 2 {
+		t.Fatalf("expected each streamer to receive its own response, got %v", partials)
+	}
+}
+
+func TestPipelineValidatorUsage(t *testing.T) {
+	model := &utils.TestingModel{Responses: map[string][]string{
+		"ping": {"pong1"},
+		"try again\nllm produced an invalid response": {"pong2"},
+	}}
+	pipeline := NewFeedbackRetry(encoders.NewFixed(""), parsers.NewRaw(), feedbacks.NewErrString(), model, 2, WithValidator[string, string](&usageValidator{nFails: 1}))
+	resp, err := pipeline.Call(context.Background(), "ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Result != "pong2" || resp.Usage != (jpf.Usage{InputTokens: 6, SuccessfulCalls: 2}) {
+		t.Fatalf("expected the usage of both validations to be included, got %v with usage %v", resp.Result, resp.Usage)
+	}
+}
+
+func TestPipelineParserUsageAndContext(t *testing.T) {
+	type ctxKey struct{}
+	sawContext := false
+	parser := parsers.OneOf(
+		parsers.NewJson[int](),
+		jpf.NewContextParser(func(ctx context.Context, response string) (int, jpf.Usage, error) {
+			sawContext = ctx.Value(ctxKey{}) == "value"
+			return len(response), jpf.Usage{OutputTokens: 7, SuccessfulCalls: 1}, nil
+		}),
+	)
+	model := &utils.TestingModel{Responses: map[string][]string{
+		"ping": {"pong"},
+	}}
+	pipeline := NewOneShot(encoders.NewFixed(""), parser, model, WithValidator[string, int](jpf.NewContextValidator(func(context.Context, string, int) (jpf.Usage, error) {
+		return jpf.Usage{InputTokens: 2, SuccessfulCalls: 1}, nil
+	})))
+	resp, err := pipeline.Call(context.WithValue(context.Background(), ctxKey{}, "value"), "ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Result != 4 || !sawContext {
+		t.Fatalf("expected the context parser to be called with the pipeline context, got %v (saw context: %v)", resp.Result, sawContext)
+	}
+	if resp.Usage != (jpf.Usage{InputTokens: 2, OutputTokens: 7, SuccessfulCalls: 2}) {
+		t.Fatalf("expected the parser and validator usage to be included, got %v", resp.Usage)
+	}
+}
+
+func TestPipelineFeedbackAttempt(t *testing.T) {
+	model := &utils.TestingModel{Responses: map[string][]string{
+		"ping":      {"1"},
+		"attempt 1": {"2"},
+		"attempt 2": {"3"},
+	}}
+	validator := validatorFunc[string, string](func(_, out string) error {
+		if out != "3" {
+			return jpf.ErrInvalidResponse
+		}
+		return nil
+	})
+	pipeline := NewFeedbackRetry(encoders.NewFixed(""), parsers.NewRaw(), feedbacks.NewTemplate("attempt {{.Attempt}}"), model, 2, WithValidator[string, string](validator))
+	resp, err := pipeline.Call(context.Background(), "ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Result != "3" {
+		t.Fatalf("expected the third response, got %v", resp.Result)
+	}
+}
+
+type validatorFunc[T, U any] func(T, U) error
+
+func (f validatorFunc[T, U]) ValidateParsedResponse(in T, out U) error { return f(in, out) }
+
+// recordingModel replies with its responses in order, recording the messages of every call.
+type recordingModel struct {
+	responses []string
+	calls     [][]jpf.Message
+}
+
+func (m *recordingModel) Respond(_ context.Context, msgs []jpf.Message, _ ...jpf.ModelResponseOpt) (jpf.ModelResponse, error) {
+	m.calls = append(m.calls, slices.Clone(msgs))
+	resp := m.responses[0]
+	m.responses = m.responses[1:]
+	return jpf.ModelResponse{Message: jpf.AssistantMessage{Content: resp}}, nil
+}
+
+func TestPipelineFeedbackHistory(t *testing.T) {
+	system := jpf.SystemMessage{Content: "sys"}
+	input := jpf.UserMessage{Content: "ping"}
+	feedback := func(n string) string { return "bad " + n + "\nllm produced an invalid response" }
+	cases := []struct {
+		name     string
+		opts     []ConstructionOpt[string, int]
+		expected []jpf.Message
+	}{
+		{
+			name: "keep all",
+			expected: []jpf.Message{
+				system, input,
+				jpf.AssistantMessage{Content: "1"}, jpf.UserMessage{Content: feedback("1")},
+				jpf.AssistantMessage{Content: "2"}, jpf.UserMessage{Content: feedback("2")},
+			},
+		},
+		{
+			name: "keep latest as developer",
+			opts: []ConstructionOpt[string, int]{WithHistoryStrategy[string, int](KeepLatestAttempt), WithFeedbackRole[string, int](jpf.DeveloperRole)},
+			expected: []jpf.Message{
+				system, input,
+				jpf.AssistantMessage{Content: "2"}, jpf.DeveloperMessage{Content: feedback("2")},
+			},
+		},
+		{
+			name: "restart",
+			opts: []ConstructionOpt[string, int]{WithHistoryStrategy[string, int](RestartWithFeedback)},
+			expected: []jpf.Message{
+				system, jpf.UserMessage{Content: "ping\n\n" + feedback("2")},
+			},
+		},
+		{
+			name: "restart as system",
+			opts: []ConstructionOpt[string, int]{WithHistoryStrategy[string, int](RestartWithFeedback), WithFeedbackRole[string, int](jpf.SystemRole)},
+			expected: []jpf.Message{
+				system, input, jpf.SystemMessage{Content: feedback("2")},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			model := &recordingModel{responses: []string{"1", "2", "3"}}
+			validator := validatorFunc[string, int](func(_ string, out int) error {
+				if out < 3 {
+					return errors.Join(fmt.Errorf("bad %d", out), jpf.ErrInvalidResponse)
+				}
+				return nil
+			})
+			opts := append(c.opts, WithValidator[string, int](validator))
+			pipeline := NewFeedbackRetry(encoders.NewFixed("sys"), parsers.NewJson[int](), feedbacks.NewErrString(), model, 2, opts...)
+			resp, err := pipeline.Call(context.Background(), "ping")
+			if err != nil || resp.Result != 3 {
+				t.Fatalf("expected 3, got %v (%v)", resp.Result, err)
+			}
+			last := model.calls[len(model.calls)-1]
+			if len(last) != len(c.expected) {
+				t.Fatalf("expected messages %v but got %v", c.expected, last)
+			}
+			for i := range last {
+				if !last[i].Eq(c.expected[i]) {
+					t.Fatalf("expected messages %v but got %v", c.expected, last)
+				}
+			}
+		})
+	}
+}
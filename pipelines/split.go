@@ -0,0 +1,84 @@
+package pipelines
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Splitter splits an input into chunks that are each small enough to be processed by a pipeline.
+type Splitter[T any] interface {
+	Split(T) ([]T, error)
+}
+
+// SplitterFunc is a [Splitter] that calls the function.
+type SplitterFunc[T any] func(T) ([]T, error)
+
+func (f SplitterFunc[T]) Split(input T) ([]T, error) {
+	return f(input)
+}
+
+var paragraphBreak = regexp.MustCompile(`\n\s*\n`)
+
+// SplitParagraphs creates a [Splitter] that splits text between paragraphs, packing as many paragraphs as possible into each chunk
+// without going over maxChars. Paragraphs that are too long on their own are split between words.
+func SplitParagraphs(maxChars int) Splitter[string] {
+	return SplitterFunc[string](func(text string) ([]string, error) {
+		chunks := make([]string, 0)
+		for _, chunk := range packText(paragraphBreak.Split(text, -1), "\n\n", charCount, maxChars) {
+			if len(chunk) > maxChars {
+				chunks = append(chunks, packText(strings.Fields(chunk), " ", charCount, maxChars)...)
+			} else {
+				chunks = append(chunks, chunk)
+			}
+		}
+		return chunks, nil
+	})
+}
+
+// SplitTokens creates a [Splitter] that splits text between words, packing as many words as possible into each chunk
+// without going over maxTokens. Tokens are counted by the counter, or by [EstimateTokens] if it is nil.
+// Paragraphs and line breaks are not kept.
+func SplitTokens(maxTokens int, counter func(string) int) Splitter[string] {
+	if counter == nil {
+		counter = EstimateTokens
+	}
+	return SplitterFunc[string](func(text string) ([]string, error) {
+		return packText(strings.Fields(text), " ", counter, maxTokens), nil
+	})
+}
+
+func charCount(s string) int { return len(s) }
+
+// EstimateTokens gives a rough count of the tokens in the text, assuming four characters per token, which is typical of English text.
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// packText joins consecutive parts with the separator, starting a new chunk whenever the next part would take the chunk over the maximum size.
+// The size of a chunk is the sum of the sizes of its parts and separators. Empty parts are dropped, and a part larger than the maximum is its own chunk.
+func packText(parts []string, sep string, size func(string) int, maxSize int) []string {
+	chunks := make([]string, 0)
+	current := make([]string, 0)
+	currentSize := 0
+	sepSize := size(sep)
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		partSize := size(part)
+		if len(current) > 0 && currentSize+sepSize+partSize > maxSize {
+			chunks = append(chunks, strings.Join(current, sep))
+			current, currentSize = current[:0], 0
+		}
+		if len(current) > 0 {
+			currentSize += sepSize
+		}
+		current = append(current, part)
+		currentSize += partSize
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, strings.Join(current, sep))
+	}
+	return chunks
+}
@@ -0,0 +1,107 @@
+package pipelines
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/internal/utils"
+)
+
+// parse runs the parser, using the context and reporting usage if it is a [jpf.ContextParser].
+func parse[U any](ctx context.Context, parser jpf.Parser[U], response string) (U, jpf.Usage, error) {
+	return jpf.ParserWithContext(parser).ParseResponseTextContext(ctx, response)
+}
+
+// validate runs the validator (which may be nil), using the context and reporting usage if it is a [jpf.ContextValidator].
+func validate[T, U any](ctx context.Context, validator jpf.Validator[T, U], input T, output U) (jpf.Usage, error) {
+	if validator == nil {
+		return jpf.Usage{}, nil
+	}
+	return jpf.ValidatorWithContext(validator).ValidateParsedResponseContext(ctx, input, output)
+}
+
+// formatFeedback runs the feedback generator, passing the attempt number if it is a [jpf.AttemptFeedbackGenerator].
+func formatFeedback(generator jpf.FeedbackGenerator, msg jpf.AssistantMessage, err error, attempt int) string {
+	if ag, ok := generator.(jpf.AttemptFeedbackGenerator); ok {
+		return ag.FormatAttemptFeedback(msg, err, attempt)
+	}
+	return generator.FormatFeedback(msg, err)
+}
+
+// runAll calls the function on every input, running at most concurrency calls at the same time, and returns the outputs in order.
+// Invalid responses do not stop the other calls, and are returned together with each labelled by the item name and its number (starting at 1).
+// Any other error cancels the calls that have not started yet, and is returned on its own.
+func runAll[I, O any](ctx context.Context, inputs []I, concurrency int, item string, call func(context.Context, I) (O, jpf.Usage, error)) ([]O, jpf.Usage, error) {
+	outputs := make([]O, len(inputs))
+	invalidErrs := make([]error, len(inputs))
+	var fatalErr error
+	usage := runEach(ctx, inputs, concurrency, call, func(index int, output O, err error) bool {
+		switch {
+		case err == nil:
+			outputs[index] = output
+		case errors.Is(err, jpf.ErrInvalidResponse):
+			invalidErrs[index] = fmt.Errorf("%s %d: %w", item, index+1, err)
+		default:
+			fatalErr = fmt.Errorf("%s %d: %w", item, index+1, err)
+			return false
+		}
+		return true
+	})
+	if fatalErr != nil {
+		return nil, usage, fatalErr
+	}
+	invalidErrs = slices.DeleteFunc(invalidErrs, func(err error) bool { return err == nil })
+	if len(invalidErrs) > 0 {
+		return nil, usage, utils.Wrap(errors.Join(invalidErrs...), "%d of %d were invalid", len(invalidErrs), len(inputs))
+	}
+	return outputs, usage, nil
+}
+
+// runEach calls the function on every input, running at most concurrency calls at the same time, and passes each result to handle as it finishes.
+// If handle returns false, the calls that are still running are cancelled and no more are started.
+// Handle is never called concurrently, and the returned usage includes every call that was started.
+func runEach[I, O any](ctx context.Context, inputs []I, concurrency int, call func(context.Context, I) (O, jpf.Usage, error), handle func(index int, output O, err error) bool) jpf.Usage {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		index  int
+		output O
+		usage  jpf.Usage
+		err    error
+	}
+	results := make(chan result, len(inputs))
+	started := 0
+	start := func() {
+		i := started
+		started++
+		go func() {
+			output, usage, err := call(ctx, inputs[i])
+			results <- result{i, output, usage, err}
+		}()
+	}
+	for range min(max(concurrency, 1), len(inputs)) {
+		start()
+	}
+
+	usage := jpf.Usage{}
+	stopped := false
+	// New calls are only started as others finish, so nothing more is started once stopped.
+	// Every started call is still received, so that the usage of cancelled calls is counted.
+	for received := 0; received < started; received++ {
+		r := <-results
+		usage = usage.Add(r.usage)
+		if stopped {
+			continue
+		}
+		if !handle(r.index, r.output, r.err) {
+			stopped = true
+			cancel()
+		} else if started < len(inputs) {
+			start()
+		}
+	}
+	return usage
+}
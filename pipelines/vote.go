@@ -0,0 +1,143 @@
+package pipelines
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/internal/utils"
+)
+
+// Vote is the consensus reached by a voting pipeline.
+type Vote[U any] struct {
+	// The result that received the most votes.
+	Result U
+	// The number of samples that agreed with the result.
+	Votes int
+	// The number of samples that produced a valid result.
+	Samples int
+	// The fraction of valid samples that agreed with the result, between 0 and 1.
+	Agreement float64
+}
+
+// NewVote creates a [Pipeline] that calls the pipeline n times concurrently and returns the result that the most samples agreed on.
+// To sample a model directly, wrap it in a pipeline such as [NewOneShot] (the model should not be cached, or every sample will be the same).
+// Samples that produce invalid responses do not vote, and an invalid response is only returned if no sample was valid.
+// Ties go to the result that was seen first. Usage is summed across all samples.
+func NewVote[T, U any](pipeline jpf.Pipeline[T, U], n int, opts ...VoteOpt[U]) jpf.Pipeline[T, Vote[U]] {
+	if n < 1 {
+		panic("NewVote requires at least one sample")
+	}
+	p := &votePipeline[T, U]{
+		pipeline: pipeline,
+		n:        n,
+		settings: voteSettings[U]{concurrency: n},
+	}
+	for _, o := range opts {
+		o(&p.settings)
+	}
+	return p
+}
+
+type VoteOpt[U any] func(*voteSettings[U])
+
+type voteSettings[U any] struct {
+	concurrency int
+	key         func(U) string
+	quorum      int
+}
+
+// Run at most n samples at the same time. By default, all samples are run at once.
+func WithVoteConcurrency[U any](n int) VoteOpt[U] {
+	return func(s *voteSettings[U]) { s.concurrency = max(n, 1) }
+}
+
+// Group results by the key instead of by equality, for example to only vote on one field of the result.
+func WithVoteKey[U any](key func(U) string) VoteOpt[U] {
+	return func(s *voteSettings[U]) { s.key = key }
+}
+
+// Stop sampling as soon as one result has received n votes, cancelling any samples that are still running.
+func WithQuorum[U any](n int) VoteOpt[U] {
+	return func(s *voteSettings[U]) { s.quorum = n }
+}
+
+type votePipeline[T, U any] struct {
+	pipeline jpf.Pipeline[T, U]
+	n        int
+	settings voteSettings[U]
+}
+
+type voteGroup[U any] struct {
+	result U
+	key    string
+	votes  int
+}
+
+func (p *votePipeline[T, U]) Call(ctx context.Context, input T) (jpf.PipelineResponse[Vote[U]], error) {
+	groups := make([]*voteGroup[U], 0)
+	valid := 0
+	invalidErrs := make([]error, 0)
+	var fatalErr error
+	samples := slices.Repeat([]T{input}, p.n)
+	usage := runEach(ctx, samples, p.settings.concurrency, func(ctx context.Context, input T) (U, jpf.Usage, error) {
+		resp, err := p.pipeline.Call(ctx, input)
+		return resp.Result, resp.Usage, err
+	}, func(_ int, result U, err error) bool {
+		switch {
+		case err == nil:
+			valid++
+			group := p.vote(groups, result)
+			if group.votes == 1 {
+				groups = append(groups, group)
+			}
+			return p.settings.quorum <= 0 || group.votes < p.settings.quorum
+		case errors.Is(err, jpf.ErrInvalidResponse):
+			invalidErrs = append(invalidErrs, err)
+			return true
+		default:
+			fatalErr = err
+			return false
+		}
+	})
+
+	if fatalErr != nil {
+		return jpf.PipelineResponse[Vote[U]]{Usage: usage}, utils.Wrap(fatalErr, "failed to sample pipeline")
+	}
+	if valid == 0 {
+		invalidErrs = slices.Insert(invalidErrs, 0, errors.New("no samples produced a valid response"))
+		return jpf.PipelineResponse[Vote[U]]{Usage: usage}, errors.Join(invalidErrs...)
+	}
+	winner := groups[0]
+	for _, g := range groups[1:] {
+		if g.votes > winner.votes {
+			winner = g
+		}
+	}
+	return jpf.PipelineResponse[Vote[U]]{
+		Result: Vote[U]{
+			Result:    winner.result,
+			Votes:     winner.votes,
+			Samples:   valid,
+			Agreement: float64(winner.votes) / float64(valid),
+		},
+		Usage: usage,
+	}, nil
+}
+
+// vote adds a vote for the result to its group, returning a new group if it did not match any existing group.
+func (p *votePipeline[T, U]) vote(groups []*voteGroup[U], result U) *voteGroup[U] {
+	key := ""
+	if p.settings.key != nil {
+		key = p.settings.key(result)
+	}
+	for _, g := range groups {
+		if (p.settings.key != nil && g.key == key) || (p.settings.key == nil && reflect.DeepEqual(g.result, result)) {
+			g.votes++
+			return g
+		}
+	}
+	return &voteGroup[U]{result: result, key: key, votes: 1}
+}
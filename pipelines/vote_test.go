@@ -0,0 +1,106 @@
+package pipelines
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/JoshPattman/jpf"
+)
+
+// sequencePipeline returns its responses in order, one per call, with one successful call of usage each.
+// A response starting with "invalid" or "fatal" is returned as an error instead.
+type sequencePipeline struct {
+	lock      sync.Mutex
+	responses []string
+	calls     int
+}
+
+func (p *sequencePipeline) Call(ctx context.Context, _ string) (jpf.PipelineResponse[string], error) {
+	p.lock.Lock()
+	resp := p.responses[p.calls]
+	p.calls++
+	p.lock.Unlock()
+	usage := jpf.Usage{InputTokens: 1, SuccessfulCalls: 1}
+	switch {
+	case strings.HasPrefix(resp, "invalid"):
+		return jpf.PipelineResponse[string]{Usage: usage}, errors.Join(errors.New(resp), jpf.ErrInvalidResponse)
+	case strings.HasPrefix(resp, "fatal"):
+		return jpf.PipelineResponse[string]{Usage: usage}, errors.New(resp)
+	}
+	return jpf.PipelineResponse[string]{Result: resp, Usage: usage}, nil
+}
+
+func TestVote(t *testing.T) {
+	cases := []struct {
+		name          string
+		responses     []string
+		opts          []VoteOpt[string]
+		expected      Vote[string]
+		expectedCalls int
+		expectedErr   error
+	}{
+		{
+			name:          "majority",
+			responses:     []string{"cat", "dog", "cat", "invalid", "cat"},
+			expected:      Vote[string]{Result: "cat", Votes: 3, Samples: 4, Agreement: 0.75},
+			expectedCalls: 5,
+		},
+		{
+			name:          "key",
+			responses:     []string{"Dog", "cat", "dog"},
+			opts:          []VoteOpt[string]{WithVoteKey(strings.ToLower)},
+			expected:      Vote[string]{Result: "Dog", Votes: 2, Samples: 3, Agreement: 2.0 / 3},
+			expectedCalls: 3,
+		},
+		{
+			name:          "quorum",
+			responses:     []string{"cat", "dog", "cat", "dog", "dog"},
+			opts:          []VoteOpt[string]{WithVoteConcurrency[string](1), WithQuorum[string](2)},
+			expected:      Vote[string]{Result: "cat", Votes: 2, Samples: 3, Agreement: 2.0 / 3},
+			expectedCalls: 3,
+		},
+		{
+			name:          "all invalid",
+			responses:     []string{"invalid 1", "invalid 2"},
+			expectedErr:   jpf.ErrInvalidResponse,
+			expectedCalls: 2,
+		},
+		{
+			name:          "fatal",
+			responses:     []string{"cat", "fatal", "cat"},
+			opts:          []VoteOpt[string]{WithVoteConcurrency[string](1)},
+			expectedErr:   errors.New("fatal"),
+			expectedCalls: 2,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			inner := &sequencePipeline{responses: c.responses}
+			resp, err := NewVote(inner, len(c.responses), c.opts...).Call(context.Background(), "")
+			if inner.calls != c.expectedCalls {
+				t.Fatalf("expected %d calls but got %d", c.expectedCalls, inner.calls)
+			}
+			if resp.Usage.SuccessfulCalls != c.expectedCalls {
+				t.Fatalf("expected usage of %d calls but got %v", c.expectedCalls, resp.Usage)
+			}
+			if c.expectedErr != nil {
+				if err == nil {
+					t.Fatal("expected an error but got none")
+				}
+				if errors.Is(c.expectedErr, jpf.ErrInvalidResponse) != errors.Is(err, jpf.ErrInvalidResponse) {
+					t.Fatalf("expected error like %v but got %v", c.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Result != c.expected {
+				t.Fatalf("expected %+v but got %+v", c.expected, resp.Result)
+			}
+		})
+	}
+}
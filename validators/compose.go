@@ -0,0 +1,123 @@
+package validators
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/internal/utils"
+)
+
+// All creates a [jpf.Validator] that runs every validator, returning all of their errors joined together.
+// It is a [jpf.ContextValidator], passing the context to and summing the usage of the validators it runs.
+func All[T, U any](validators ...jpf.Validator[T, U]) jpf.Validator[T, U] {
+	return &allValidator[T, U]{validators: validators}
+}
+
+type allValidator[T, U any] struct {
+	validators []jpf.Validator[T, U]
+}
+
+func (v *allValidator[T, U]) ValidateParsedResponse(input T, output U) error {
+	_, err := v.ValidateParsedResponseContext(context.Background(), input, output)
+	return err
+}
+
+func (v *allValidator[T, U]) ValidateParsedResponseContext(ctx context.Context, input T, output U) (jpf.Usage, error) {
+	totalUsage := jpf.Usage{}
+	errs := []error{}
+	for _, validator := range v.validators {
+		usage, err := jpf.ValidatorWithContext(validator).ValidateParsedResponseContext(ctx, input, output)
+		totalUsage = totalUsage.Add(usage)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return totalUsage, errors.Join(errs...)
+}
+
+// Any creates a [jpf.Validator] that passes if at least one of the validators passes.
+// If none pass, the errors from all of them are returned joined together, explaining that only one needs to be fixed.
+// It is a [jpf.ContextValidator], like [All].
+func Any[T, U any](validators ...jpf.Validator[T, U]) jpf.Validator[T, U] {
+	return &anyValidator[T, U]{validators: validators}
+}
+
+type anyValidator[T, U any] struct {
+	validators []jpf.Validator[T, U]
+}
+
+func (v *anyValidator[T, U]) ValidateParsedResponse(input T, output U) error {
+	_, err := v.ValidateParsedResponseContext(context.Background(), input, output)
+	return err
+}
+
+func (v *anyValidator[T, U]) ValidateParsedResponseContext(ctx context.Context, input T, output U) (jpf.Usage, error) {
+	totalUsage := jpf.Usage{}
+	errs := []error{}
+	for i, validator := range v.validators {
+		usage, err := jpf.ValidatorWithContext(validator).ValidateParsedResponseContext(ctx, input, output)
+		totalUsage = totalUsage.Add(usage)
+		if err == nil {
+			return totalUsage, nil
+		}
+		errs = append(errs, fmt.Errorf("option %d: %w", i+1, err))
+	}
+	return totalUsage, utils.Wrap(errors.Join(append(errs, jpf.ErrInvalidResponse)...), "the response must satisfy at least one of the following options")
+}
+
+// Field creates a [jpf.Validator] that runs the validators on a single field of the parsed response, selected by get.
+// Errors are prefixed with the name of the field.
+// It is a [jpf.ContextValidator], like [All].
+func Field[T, U, F any](name string, get func(U) F, validators ...jpf.Validator[T, F]) jpf.Validator[T, U] {
+	return &fieldValidator[T, U, F]{name: name, get: get, validator: jpf.ValidatorWithContext(All(validators...))}
+}
+
+type fieldValidator[T, U, F any] struct {
+	name      string
+	get       func(U) F
+	validator jpf.ContextValidator[T, F]
+}
+
+func (v *fieldValidator[T, U, F]) ValidateParsedResponse(input T, output U) error {
+	_, err := v.ValidateParsedResponseContext(context.Background(), input, output)
+	return err
+}
+
+func (v *fieldValidator[T, U, F]) ValidateParsedResponseContext(ctx context.Context, input T, output U) (jpf.Usage, error) {
+	usage, err := v.validator.ValidateParsedResponseContext(ctx, input, v.get(output))
+	if err != nil {
+		return usage, fmt.Errorf("in field '%s': %w", v.name, err)
+	}
+	return usage, nil
+}
+
+// Func creates a [jpf.Validator] from a function, which has access to both the input and the parsed response, so may check one against the other.
+// Errors are joined with [jpf.ErrInvalidResponse] if they are not already.
+func Func[T, U any](validate func(T, U) error) jpf.Validator[T, U] {
+	return &funcValidator[T, U]{validate: validate}
+}
+
+type funcValidator[T, U any] struct {
+	validate func(T, U) error
+}
+
+func (v *funcValidator[T, U]) ValidateParsedResponse(input T, output U) error {
+	err := v.validate(input, output)
+	if err != nil && !errors.Is(err, jpf.ErrInvalidResponse) {
+		return errors.Join(err, jpf.ErrInvalidResponse)
+	}
+	return err
+}
+
+// Check creates a [jpf.Validator] that fails with the message if the condition is false.
+// The message should explain to the model what it must do, for example "the summary must be shorter than the input text".
+func Check[T, U any](condition func(T, U) bool, message string) jpf.Validator[T, U] {
+	return Func(func(input T, output U) error {
+		if condition(input, output) {
+			return nil
+		}
+		return errors.New(message)
+	})
+}
@@ -0,0 +1,89 @@
+package validators
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/internal/utils"
+)
+
+// JudgeInput is the data encoded into the judging prompt: the input to the pipeline, and the parsed response to judge.
+type JudgeInput[T, U any] struct {
+	Input  T
+	Output U
+}
+
+// Verdict is the decision of a judge.
+// It can be parsed from json with the keys "pass" and "critique", for example with parsers.NewJson[validators.Verdict]().
+type Verdict struct {
+	// Whether the response is acceptable.
+	Pass bool `json:"pass"`
+	// What is wrong with the response, and how to fix it. This is passed back to the model being judged.
+	Critique string `json:"critique"`
+}
+
+// NewJudge creates a [jpf.Validator] that asks a second model to judge the response, for checks that can only be done semantically
+// (for example, "is this translation faithful?").
+// The encoder builds the judging prompt from the input and parsed response, and the parser reads the [Verdict] from the judge's response.
+// When the judge does not pass the response, its critique is returned joined with [jpf.ErrInvalidResponse],
+// so pipelines such as pipelines.NewFeedbackRetry pass the critique back to the model.
+// It is a [jpf.ContextValidator], so the usage of the judge is included in the pipeline's usage.
+// Failures of the judge itself are returned as described in [AskJudge].
+func NewJudge[T, U any](model jpf.Model, encoder jpf.Encoder[JudgeInput[T, U]], parser jpf.Parser[Verdict]) jpf.Validator[T, U] {
+	return &judgeValidator[T, U]{
+		model:   model,
+		encoder: encoder,
+		parser:  parser,
+	}
+}
+
+type judgeValidator[T, U any] struct {
+	model   jpf.Model
+	encoder jpf.Encoder[JudgeInput[T, U]]
+	parser  jpf.Parser[Verdict]
+}
+
+func (v *judgeValidator[T, U]) ValidateParsedResponse(input T, output U) error {
+	_, err := v.ValidateParsedResponseContext(context.Background(), input, output)
+	return err
+}
+
+func (v *judgeValidator[T, U]) ValidateParsedResponseContext(ctx context.Context, input T, output U) (jpf.Usage, error) {
+	verdict, usage, err := AskJudge(ctx, v.model, v.encoder, v.parser, input, output)
+	if err != nil {
+		return usage, err
+	}
+	if verdict.Pass {
+		return usage, nil
+	}
+	critique := verdict.Critique
+	if critique == "" {
+		critique = "no reason was given"
+	}
+	return usage, utils.Wrap(errors.Join(errors.New(critique), jpf.ErrInvalidResponse), "the response was rejected by a reviewer")
+}
+
+// AskJudge asks a second model about the response, using the encoder to build the judging prompt and the parser to read its answer.
+// It is used by [NewJudge], and can be used to build other judges, such as ones that score responses instead of passing or failing them.
+// If the parser is a [jpf.ContextParser], it is given the context and its usage is included in the returned usage.
+// If the judge's own response cannot be parsed, or the judge model fails, an error that is not an invalid response is returned.
+func AskJudge[T, U, V any](ctx context.Context, model jpf.Model, encoder jpf.Encoder[JudgeInput[T, U]], parser jpf.Parser[V], input T, output U) (V, jpf.Usage, error) {
+	var zero V
+	msgs, err := encoder.BuildInputMessages(JudgeInput[T, U]{Input: input, Output: output})
+	if err != nil {
+		return zero, jpf.Usage{}, utils.Wrap(err, "failed to build judge input messages")
+	}
+	resp, err := model.Respond(ctx, msgs)
+	if err != nil {
+		return zero, resp.Usage, utils.Wrap(err, "failed to get judge response")
+	}
+	answer, parseUsage, err := jpf.ParserWithContext(parser).ParseResponseTextContext(ctx, resp.Message.Content)
+	usage := resp.Usage.Add(parseUsage)
+	if err != nil {
+		// The judge's mistake should not be blamed on the model being judged, so the error must not be an invalid response.
+		return zero, usage, fmt.Errorf("judge returned an invalid response: %s", err)
+	}
+	return answer, usage, nil
+}
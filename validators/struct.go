@@ -0,0 +1,291 @@
+package validators
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/JoshPattman/jpf"
+)
+
+// NewStruct creates a [jpf.Validator] that checks the fields of the parsed response against the rules in their validate struct tags.
+// Rules are separated by commas, for example `validate:"required,maxlen=100"`. The supported rules are:
+//   - required: the value must not be empty (zero, an empty string, slice or map, or nil).
+//   - minlen=N, maxlen=N: strings must have at least / at most N characters, and slices and maps at least / at most N items.
+//   - min=X, max=X: numbers must be at least / at most X.
+//   - oneof=a|b|c: the value (a string or number) must be one of the listed values.
+//   - pattern=RE: strings must match the regular expression. As it may contain commas, this must be the last rule.
+//
+// Nested structs, and slices and maps of structs, are also checked. Nil pointers are only checked by required.
+// Fields are named by their json tag in errors, as that is what the model will have seen.
+// Every violation is returned together, joined with [jpf.ErrInvalidResponse].
+// U must be a struct, and NewStruct panics if any rule is invalid.
+func NewStruct[T, U any]() jpf.Validator[T, U] {
+	typ := reflect.TypeFor[U]()
+	if typ.Kind() != reflect.Struct {
+		panic("NewStruct: U must be a struct")
+	}
+	return &structValidator[T, U]{
+		fields: structRulesOf(typ, map[reflect.Type]*structRules{}).fields,
+	}
+}
+
+type structValidator[T, U any] struct {
+	fields []fieldRules
+}
+
+func (v *structValidator[T, U]) ValidateParsedResponse(_ T, output U) error {
+	errs := checkStruct(reflect.ValueOf(output), v.fields, "")
+	if len(errs) > 0 {
+		return errors.Join(append(errs, jpf.ErrInvalidResponse)...)
+	}
+	return nil
+}
+
+// structRules are the rules for the fields of a struct type, shared by every field of that type so that recursive types can refer to themselves.
+type structRules struct {
+	fields   []fieldRules
+	building bool
+}
+
+type fieldRules struct {
+	index  int
+	name   string
+	rules  []rule
+	nested *structRules
+}
+
+type rule struct {
+	name string
+	// check checks a value (which is only nil for required), returning a description of the problem (to follow the field name) or an empty string.
+	check func(reflect.Value) string
+}
+
+// structRulesOf builds the rules for a struct type, reusing the rules in seen for types that have already been built or are being built.
+func structRulesOf(typ reflect.Type, seen map[reflect.Type]*structRules) *structRules {
+	if rules, ok := seen[typ]; ok {
+		return rules
+	}
+	rules := &structRules{building: true}
+	seen[typ] = rules
+	for i := range typ.NumField() {
+		f := typ.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		field := fieldRules{index: i, name: jsonName(f)}
+		if tag := f.Tag.Get("validate"); tag != "" && tag != "-" {
+			field.rules = parseRules(tag, f)
+		}
+		if nested := nestedStruct(f.Type); nested != nil {
+			field.nested = structRulesOf(nested, seen)
+		}
+		// A type that is still being built is recursive, and may have rules that have not been added yet.
+		if len(field.rules) > 0 || (field.nested != nil && (field.nested.building || len(field.nested.fields) > 0)) {
+			rules.fields = append(rules.fields, field)
+		}
+	}
+	rules.building = false
+	return rules
+}
+
+// nestedStruct returns the struct type that should be recursed into for a field type, if any.
+func nestedStruct(typ reflect.Type) reflect.Type {
+	for typ.Kind() == reflect.Pointer || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array || typ.Kind() == reflect.Map {
+		typ = typ.Elem()
+	}
+	if typ.Kind() == reflect.Struct {
+		return typ
+	}
+	return nil
+}
+
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return f.Name
+	}
+	return name
+}
+
+func parseRules(tag string, f reflect.StructField) []rule {
+	rules := []rule{}
+	for tag != "" {
+		var part string
+		if strings.HasPrefix(tag, "pattern=") {
+			part, tag = tag, ""
+		} else {
+			part, tag, _ = strings.Cut(tag, ",")
+		}
+		name, arg, _ := strings.Cut(part, "=")
+		check, err := buildRule(name, arg, f.Type)
+		if err != nil {
+			panic(fmt.Sprintf("NewStruct: invalid rule %q on field %s: %v", part, f.Name, err))
+		}
+		rules = append(rules, rule{name, check})
+	}
+	return rules
+}
+
+func buildRule(name, arg string, typ reflect.Type) (func(reflect.Value) string, error) {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	switch name {
+	case "required":
+		return func(v reflect.Value) string {
+			if v.IsZero() || ((v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.Len() == 0) ||
+				(v.Kind() == reflect.String && strings.TrimSpace(v.String()) == "") {
+				return "is required but was missing or empty"
+			}
+			return ""
+		}, nil
+	case "minlen", "maxlen":
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, err
+		}
+		unit := "items"
+		switch typ.Kind() {
+		case reflect.String:
+			unit = "characters"
+		case reflect.Slice, reflect.Array, reflect.Map:
+		default:
+			return nil, fmt.Errorf("%s only applies to strings, slices and maps", name)
+		}
+		return func(v reflect.Value) string {
+			l := v.Len()
+			if v.Kind() == reflect.String {
+				l = utf8.RuneCountInString(v.String())
+			}
+			if name == "minlen" && l < n {
+				return fmt.Sprintf("must have at least %d %s (got %d)", n, unit, l)
+			}
+			if name == "maxlen" && l > n {
+				return fmt.Sprintf("must have at most %d %s (got %d)", n, unit, l)
+			}
+			return ""
+		}, nil
+	case "min", "max":
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, err
+		}
+		if !isNumber(typ) {
+			return nil, fmt.Errorf("%s only applies to numbers", name)
+		}
+		return func(v reflect.Value) string {
+			n := numberOf(v)
+			if name == "min" && n < limit {
+				return fmt.Sprintf("must be at least %s (got %v)", arg, v.Interface())
+			}
+			if name == "max" && n > limit {
+				return fmt.Sprintf("must be at most %s (got %v)", arg, v.Interface())
+			}
+			return ""
+		}, nil
+	case "oneof":
+		options := strings.Split(arg, "|")
+		if typ.Kind() != reflect.String && !isNumber(typ) {
+			return nil, errors.New("oneof only applies to strings and numbers")
+		}
+		return func(v reflect.Value) string {
+			got := fmt.Sprint(v.Interface())
+			if slices.Contains(options, got) {
+				return ""
+			}
+			if v.Kind() == reflect.String {
+				got = strconv.Quote(got)
+			}
+			return fmt.Sprintf("must be one of %s (got %s)", strings.Join(options, ", "), got)
+		}, nil
+	case "pattern":
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, err
+		}
+		if typ.Kind() != reflect.String {
+			return nil, errors.New("pattern only applies to strings")
+		}
+		return func(v reflect.Value) string {
+			if !re.MatchString(v.String()) {
+				return fmt.Sprintf("must match the pattern %s (got %q)", arg, v.String())
+			}
+			return ""
+		}, nil
+	default:
+		return nil, errors.New("unknown rule")
+	}
+}
+
+func checkStruct(v reflect.Value, fields []fieldRules, prefix string) []error {
+	errs := []error{}
+	for _, field := range fields {
+		path := prefix + field.name
+		fv := v.Field(field.index)
+		ev := fv
+		for ev.Kind() == reflect.Pointer && !ev.IsNil() {
+			ev = ev.Elem()
+		}
+		isNil := ev.Kind() == reflect.Pointer
+		for _, r := range field.rules {
+			if isNil && r.name != "required" {
+				continue
+			}
+			if msg := r.check(ev); msg != "" {
+				errs = append(errs, fmt.Errorf("field '%s' %s", path, msg))
+			}
+		}
+		if field.nested != nil {
+			errs = append(errs, checkNested(fv, field.nested.fields, path)...)
+		}
+	}
+	return errs
+}
+
+func checkNested(v reflect.Value, fields []fieldRules, path string) []error {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return checkNested(v.Elem(), fields, path)
+	case reflect.Struct:
+		return checkStruct(v, fields, path+".")
+	case reflect.Slice, reflect.Array:
+		errs := []error{}
+		for i := range v.Len() {
+			errs = append(errs, checkNested(v.Index(i), fields, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return errs
+	case reflect.Map:
+		errs := []error{}
+		keys := v.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int { return strings.Compare(fmt.Sprint(a), fmt.Sprint(b)) })
+		for _, k := range keys {
+			errs = append(errs, checkNested(v.MapIndex(k), fields, fmt.Sprintf("%s[%v]", path, k))...)
+		}
+		return errs
+	}
+	return nil
+}
+
+func isNumber(typ reflect.Type) bool {
+	return typ.Kind() >= reflect.Int && typ.Kind() <= reflect.Float64
+}
+
+func numberOf(v reflect.Value) float64 {
+	switch {
+	case v.CanInt():
+		return float64(v.Int())
+	case v.CanUint():
+		return float64(v.Uint())
+	default:
+		return v.Float()
+	}
+}
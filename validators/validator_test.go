@@ -0,0 +1,252 @@
+package validators
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/JoshPattman/jpf"
+	"github.com/JoshPattman/jpf/encoders"
+	"github.com/JoshPattman/jpf/internal/utils"
+	"github.com/JoshPattman/jpf/parsers"
+)
+
+type testStep struct {
+	Title string `json:"title" validate:"required"`
+}
+
+type testOutput struct {
+	Summary string     `json:"summary" validate:"required,maxlen=20"`
+	Label   string     `json:"label" validate:"oneof=positive|negative"`
+	Score   float64    `json:"score" validate:"min=0,max=1"`
+	Code    *string    `json:"code,omitempty" validate:"pattern=^[A-Z]{3}(,[A-Z]{3})*$"`
+	Steps   []testStep `json:"steps" validate:"minlen=1"`
+	Notes   string
+}
+
+func validTestOutput() testOutput {
+	code := "ABC,DEF"
+	return testOutput{
+		Summary: "short",
+		Label:   "positive",
+		Score:   0.5,
+		Code:    &code,
+		Steps:   []testStep{{Title: "one"}},
+	}
+}
+
+func buildTestingStruct() jpf.Validator[string, testOutput] {
+	return NewStruct[string, testOutput]()
+}
+
+func buildTestingComposite() jpf.Validator[string, testOutput] {
+	return All(
+		NewStruct[string, testOutput](),
+		Check(func(in string, out testOutput) bool { return len(out.Summary) < len(in) }, "the summary must be shorter than the input text"),
+		Field("steps", func(out testOutput) []testStep { return out.Steps }, Any(
+			Check(func(_ string, steps []testStep) bool { return len(steps) == 1 }, "there must be exactly one step"),
+			Check(func(_ string, steps []testStep) bool { return len(steps) > 3 }, "there must be more than three steps"),
+		)),
+	)
+}
+
+type VCase struct {
+	ID             string
+	Build          func() jpf.Validator[string, testOutput]
+	Input          string
+	Output         func(*testOutput)
+	ExpectedErrors []string
+}
+
+func (testCase VCase) Name() string { return testCase.ID }
+
+func (testCase VCase) Test() error {
+	output := validTestOutput()
+	if testCase.Output != nil {
+		testCase.Output(&output)
+	}
+	err := testCase.Build().ValidateParsedResponse(testCase.Input, output)
+	if len(testCase.ExpectedErrors) == 0 {
+		if err != nil {
+			return errors.Join(fmt.Errorf("expecting no error, got one"), err)
+		}
+		return nil
+	}
+	if !errors.Is(err, jpf.ErrInvalidResponse) {
+		return fmt.Errorf("expected an invalid response error, got %v", err)
+	}
+	for _, expected := range testCase.ExpectedErrors {
+		if !strings.Contains(err.Error(), expected) {
+			return fmt.Errorf("expected error to contain %q, got:\n%v", expected, err)
+		}
+	}
+	return nil
+}
+
+var VCases = []utils.TestCase{
+	VCase{
+		ID:    "struct/valid",
+		Build: buildTestingStruct,
+	},
+	VCase{
+		ID:    "struct/nil_pointer_skips_rules",
+		Build: buildTestingStruct,
+		Output: func(o *testOutput) {
+			o.Code = nil
+		},
+	},
+	VCase{
+		ID:    "struct/all_violations",
+		Build: buildTestingStruct,
+		Output: func(o *testOutput) {
+			code := "abc"
+			o.Summary = "  "
+			o.Label = "meh"
+			o.Score = 1.5
+			o.Code = &code
+			o.Steps = []testStep{{Title: "one"}, {}}
+		},
+		ExpectedErrors: []string{
+			"field 'summary' is required but was missing or empty",
+			`field 'label' must be one of positive, negative (got "meh")`,
+			"field 'score' must be at most 1 (got 1.5)",
+			`field 'code' must match the pattern ^[A-Z]{3}(,[A-Z]{3})*$ (got "abc")`,
+			"field 'steps[1].title' is required",
+		},
+	},
+	VCase{
+		ID:    "struct/lengths",
+		Build: buildTestingStruct,
+		Output: func(o *testOutput) {
+			o.Summary = strings.Repeat("é", 21)
+			o.Steps = nil
+			o.Score = -1
+		},
+		ExpectedErrors: []string{
+			"field 'summary' must have at most 20 characters (got 21)",
+			"field 'steps' must have at least 1 items (got 0)",
+			"field 'score' must be at least 0 (got -1)",
+		},
+	},
+	VCase{
+		ID:    "composite/valid",
+		Build: buildTestingComposite,
+		Input: "a much longer input text",
+	},
+	VCase{
+		ID:    "composite/cross_field",
+		Build: buildTestingComposite,
+		Input: "tiny",
+		ExpectedErrors: []string{
+			"the summary must be shorter than the input text",
+		},
+	},
+	VCase{
+		ID:    "composite/any_fails",
+		Build: buildTestingComposite,
+		Input: "a much longer input text",
+		Output: func(o *testOutput) {
+			o.Steps = []testStep{{Title: "a"}, {Title: "b"}}
+		},
+		ExpectedErrors: []string{
+			"in field 'steps': the response must satisfy at least one of the following options",
+			"option 1: there must be exactly one step",
+			"option 2: there must be more than three steps",
+		},
+	},
+}
+
+func TestValidators(t *testing.T) {
+	utils.RunTests(t, VCases)
+}
+
+func TestInvalidRulesPanic(t *testing.T) {
+	type badRule struct {
+		Name string `validate:"min=3"`
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected NewStruct to panic on a rule that does not apply to the field type")
+		}
+	}()
+	NewStruct[string, badRule]()
+}
+
+type testNode struct {
+	Children []testNode `json:"children"`
+	Name     string     `json:"name" validate:"required"`
+	Parent   *testNode  `json:"parent"`
+}
+
+func TestRecursiveStruct(t *testing.T) {
+	validator := NewStruct[string, testNode]()
+	node := testNode{
+		Name: "root",
+		Children: []testNode{
+			{Name: "a", Children: []testNode{{}}},
+			{Name: "b", Parent: &testNode{}},
+		},
+	}
+	err := validator.ValidateParsedResponse("", node)
+	if !errors.Is(err, jpf.ErrInvalidResponse) {
+		t.Fatalf("expected an invalid response, got %v", err)
+	}
+	for _, expected := range []string{"field 'children[0].children[0].name'", "field 'children[1].parent.name'"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected an error for %s, got %v", expected, err)
+		}
+	}
+}
+
+type judgeTestModel struct {
+	response string
+}
+
+func (m *judgeTestModel) Respond(_ context.Context, msgs []jpf.Message, _ ...jpf.ModelResponseOpt) (jpf.ModelResponse, error) {
+	return jpf.ModelResponse{
+		Message: jpf.AssistantMessage{Content: m.response},
+		Usage:   jpf.Usage{InputTokens: 10, OutputTokens: 5, SuccessfulCalls: 1},
+	}, nil
+}
+
+func TestJudge(t *testing.T) {
+	build := func(response string) jpf.Validator[string, string] {
+		return NewJudge(
+			&judgeTestModel{response},
+			encoders.NewTemplate[JudgeInput[string, string]]("Is the translation faithful?", "{{.Input}} -> {{.Output}}"),
+			parsers.NewJson[Verdict](),
+		)
+	}
+	expectedUsage := jpf.Usage{InputTokens: 20, OutputTokens: 10, SuccessfulCalls: 2}
+
+	pass := All(build(`{"pass": true}`), build(`{"pass": true}`)).(jpf.ContextValidator[string, string])
+	usage, err := pass.ValidateParsedResponseContext(context.Background(), "bonjour", "hello")
+	if err != nil || usage != expectedUsage {
+		t.Fatalf("expected a pass with usage %v, got %v (%v)", expectedUsage, usage, err)
+	}
+
+	fail := Field("translation", func(s string) string { return s }, build(`{"pass": false, "critique": "it should be informal"}`), build(`{"pass": true}`)).(jpf.ContextValidator[string, string])
+	usage, err = fail.ValidateParsedResponseContext(context.Background(), "salut", "good day")
+	if !errors.Is(err, jpf.ErrInvalidResponse) || !strings.Contains(err.Error(), "it should be informal") || usage != expectedUsage {
+		t.Fatalf("expected the critique as an invalid response with usage %v, got %v (%v)", expectedUsage, usage, err)
+	}
+
+	err = build("I think it is fine").ValidateParsedResponse("salut", "hi")
+	if err == nil || errors.Is(err, jpf.ErrInvalidResponse) {
+		t.Fatalf("expected an invalid verdict not to be an invalid response, got %v", err)
+	}
+
+	parserUsage := jpf.Usage{InputTokens: 3, OutputTokens: 2, SuccessfulCalls: 1}
+	contextParser := jpf.NewContextParser(func(ctx context.Context, text string) (Verdict, jpf.Usage, error) {
+		verdict, err := parsers.NewJson[Verdict]().ParseResponseText(text)
+		return verdict, parserUsage, err
+	})
+	encoder := encoders.NewTemplate[JudgeInput[string, string]]("Is the translation faithful?", "{{.Input}} -> {{.Output}}")
+	_, usage, err = AskJudge(context.Background(), &judgeTestModel{`{"pass": true}`}, encoder, contextParser, "bonjour", "hello")
+	expectedUsage = jpf.Usage{InputTokens: 13, OutputTokens: 7, SuccessfulCalls: 2}
+	if err != nil || usage != expectedUsage {
+		t.Fatalf("expected the parser usage to be included, giving %v, got %v (%v)", expectedUsage, usage, err)
+	}
+}